@@ -5,15 +5,18 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"reflect"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/antongulenko/golib"
 	"github.com/bitflow-stream/go-bitflow-collector"
 	"github.com/bitflow-stream/go-bitflow-collector/libvirt"
-	"github.com/bitflow-stream/go-bitflow-collector/mock"
+	_ "github.com/bitflow-stream/go-bitflow-collector/mock"
 	"github.com/bitflow-stream/go-bitflow-collector/ovsdb"
 	"github.com/bitflow-stream/go-bitflow-collector/psutil"
 	"github.com/bitflow-stream/go-bitflow/cmd"
@@ -24,12 +27,35 @@ import (
 var (
 	collect_local_interval = 500 * time.Millisecond
 	sink_interval          = 500 * time.Millisecond
+	update_timeout         = time.Duration(0) // Only the collectors in updateTimeouts are limited by default
+	update_workers         = 0
+
+	retryPolicy = collector.RetryPolicy{
+		ToleratedFailures: collector.ToleratedUpdateFailures,
+		BackoffBase:       FailedCollectorCheckInterval,
+		BackoffMax:        2 * time.Minute,
+		Jitter:            0.1,
+	}
 
 	all_metrics           = false
 	include_basic_metrics = false
 	user_include_metrics  golib.StringSlice
 	user_exclude_metrics  golib.StringSlice
 	disabled_collectors   golib.StringSlice
+	disabled_regexes      golib.StringSlice
+	tagged_samples        = false
+	self_monitoring       = false
+	consistent_snapshots  = false
+	align_sink_ticks      = false
+	tag_measurement_time  = false
+	missing_as_nan        = false
+	pin_header_file       = ""
+	pin_first_header      = false
+	spool_dir             = ""
+	spool_size_mb         = 100
+	spool_max_age         = time.Hour
+	prometheus_enabled    = false
+	prometheus_prefix     = "bitflow_"
 
 	libvirt_uri = libvirt.LocalUri // libvirt.SshUri("host", "keyFile")
 	ovsdb_host  = ""
@@ -43,6 +69,20 @@ var (
 		regexp.MustCompile("^libvirt/[^/]+$"):     30 * time.Second,        // Changed VM configuration
 	}
 
+	updateTimeouts = map[*regexp.Regexp]time.Duration{
+		regexp.MustCompile("^libvirt"): 20 * time.Second, // Remote hypervisor connections can be slow
+		regexp.MustCompile("^ovsdb"):   10 * time.Second,
+	}
+
+	// Additional rates over longer time windows, only configurable through the config file
+	metricWindows = map[*regexp.Regexp]collector.MetricWindows{}
+
+	// Retry policies for collectors matching the regexes, replaced entirely by the retry_policies section of the config file
+	retryPolicies = map[*regexp.Regexp]collector.RetryPolicy{
+		// Remote hypervisor connections are more likely to fail temporarily
+		regexp.MustCompile("^libvirt"): {ToleratedFailures: 5, BackoffBase: 10 * time.Second, BackoffMax: 5 * time.Minute, Jitter: 0.1},
+	}
+
 	ringFactory = collector.ValueRingFactory{
 		// This is an important package-wide constant: time-window for all aggregated values
 		Interval: 1000 * time.Millisecond,
@@ -82,62 +122,243 @@ func init() {
 	flag.Var(&user_exclude_metrics, "exclude", "Metrics to exclude (substring match)")
 	flag.Var(&user_include_metrics, "include", "Metrics to include exclusively (substring match)")
 	flag.BoolVar(&include_basic_metrics, "basic", include_basic_metrics, "Include only a certain basic subset of metrics")
-	flag.Var(&disabled_collectors, "disable", "Entirely disable given root-collectors (exact string match)")
+	flag.Var(&disabled_collectors, "disable", "Entirely disable given collectors (exact string match)")
+	flag.Var(&disabled_regexes, "disable-regex", "Entirely disable collectors matching the given regex, e.g. ^psutil/net-proto or ^libvirt/vm1/")
+	flag.BoolVar(&tagged_samples, "tagged", tagged_samples, "Emit a separate tagged sample for every VM, process group and OVSDB interface, instead of one sample containing all metrics")
+
+	flag.BoolVar(&consistent_snapshots, "consistent", consistent_snapshots, "Emit metric values only after complete update rounds of all collectors, tagged with the time the round finished ("+collector.RoundTimeTag+")")
+	flag.BoolVar(&align_sink_ticks, "align", align_sink_ticks, "Emit samples at multiples of the sink interval (-si), e.g. at every full 500ms, and timestamp them with the aligned time")
+	flag.BoolVar(&tag_measurement_time, "tag-measurement-time", tag_measurement_time, "Tag samples with the time of the oldest measurement among the collectors contributing to the sample ("+collector.MeasurementTimeTag+")")
+	flag.BoolVar(&missing_as_nan, "nan", missing_as_nan, "Emit NaN for the metrics of failed collectors instead of their last values, and keep these metrics until the collectors recover")
+	flag.StringVar(&pin_header_file, "pin-header", pin_header_file, "File with a fixed list of fields (one per line) that all samples contain, regardless of the collected metrics. Missing metrics are NaN, other metrics are dropped.")
+	flag.BoolVar(&pin_first_header, "pin-first-header", pin_first_header, "Keep the fields of the first collected sample when the metric collection is restarted. Missing metrics are NaN, new metrics are dropped.")
+	flag.StringVar(&spool_dir, "spool", spool_dir, "Directory for buffering samples while the data sink fails. The samples are sent in order once the sink recovers, also after a restart.")
+	flag.IntVar(&spool_size_mb, "spool-size", spool_size_mb, "Maximum size of the spool directory in MB. The oldest samples are dropped when it is exceeded.")
+	flag.DurationVar(&spool_max_age, "spool-age", spool_max_age, "Spooled samples older than this are dropped instead of being sent. Zero to keep samples regardless of their age.")
+	flag.BoolVar(&prometheus_enabled, "prometheus", prometheus_enabled, "Serve the most recent sample in the Prometheus text format through the REST API (/prometheus)")
+	flag.StringVar(&prometheus_prefix, "prometheus-prefix", prometheus_prefix, "Prefix for the metric names served through /prometheus")
+	flag.BoolVar(&self_monitoring, "self-monitoring", self_monitoring, "Add metrics describing the update duration and failures of every collector (prefixed with "+collector.SelfMonitoringPrefix+")")
 
 	flag.DurationVar(&collect_local_interval, "ci", collect_local_interval, "Interval for collecting local samples")
 	flag.DurationVar(&sink_interval, "si", sink_interval, "Interval for sinking (sending/printing/...) data when collecting local samples")
+	flag.IntVar(&retryPolicy.ToleratedFailures, "tolerated-failures", retryPolicy.ToleratedFailures, "Number of consecutive update failures after which a collector is treated as failed")
+	flag.DurationVar(&retryPolicy.BackoffBase, "retry-backoff", retryPolicy.BackoffBase, "Initial delay between checks whether a failed collector has recovered. Doubled after every unsuccessful check.")
+	flag.DurationVar(&retryPolicy.BackoffMax, "retry-backoff-max", retryPolicy.BackoffMax, "Maximum delay between checks whether a failed collector has recovered")
+	flag.Float64Var(&retryPolicy.Jitter, "retry-jitter", retryPolicy.Jitter, "Random variation of the retry delays for failed collectors (fraction between 0 and 1, e.g. 0.1 for +-10%)")
+	flag.IntVar(&update_workers, "update-workers", update_workers, "Number of goroutines updating the collectors in the order of their dependencies. Zero or negative to use one goroutine per collector.")
+	flag.DurationVar(&update_timeout, "update-timeout", update_timeout, "Timeout for the update of a single collector, after which the update is treated as failed. Zero or negative to disable (default). Every limited update runs in an additional goroutine. Libvirt and OVSDB collectors always use their own timeouts.")
 
 	flag.Var(&pcap_nics, "nic", "NICs to capture packets from for PCAP-based "+
 		"monitoring of process network IO (/proc/.../net-pcap/...). Defaults to all physical NICs.")
 }
 
 func createCollectorSource(helper *cmd.CmdDataCollector) *collector.SampleSource {
-	psutil.PcapNics = pcap_nics
-	ringFactory.Length = int(float64(ringFactory.Interval) / float64(collect_local_interval) * 10) // Make sure enough samples can be buffered
-	if ringFactory.Length <= 0 {
-		ringFactory.Length = 1
+	source := &collector.SampleSource{
+		UpdateTimeouts:                 updateTimeouts,
+		FailedCollectorCheckInterval:   FailedCollectorCheckInterval,
+		FilteredCollectorCheckInterval: FilteredCollectorCheckInterval,
 	}
-	var cols []collector.Collector
+	golib.Checkerr(configureSource(source))
+	helper.RestApis = append(helper.RestApis, &AvailableMetricsApi{Source: source}, &multiProcApi)
+	return source
+}
+
+type createdRootCollectors struct {
+	parameters map[string]string
+	collectors []collector.Collector
+}
 
-	cols = append(cols, mock.NewMockCollector(&ringFactory))
-	cols = append(cols, createProcessCollectors(helper)...)
-	cols = append(cols, libvirt.NewLibvirtCollector(libvirt_uri, libvirt.NewDriver(), &ringFactory))
-	cols = append(cols, ovsdb.NewOvsdbCollector(ovsdb_host, &ringFactory))
+// The root collectors created from the factories in collector.Registry. They are only re-created when their parameters change.
+var rootCollectors = make(map[string]*createdRootCollectors)
 
-	if all_metrics {
-		excludeMetricsRegexes = nil
+func createRootCollectors() ([]collector.Collector, error) {
+	var res []collector.Collector
+	for _, factory := range collector.Registry.Factories() {
+		if !collectorEnabled(factory.Name) {
+			delete(rootCollectors, factory.Name)
+			continue
+		}
+		params := collectorParameters(factory.Name)
+		created, ok := rootCollectors[factory.Name]
+		if !ok || !reflect.DeepEqual(created.parameters, params) {
+			cols, err := factory.Create(params, &ringFactory)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to create collector %v: %v", factory.Name, err)
+			}
+			created = &createdRootCollectors{parameters: params, collectors: cols}
+			rootCollectors[factory.Name] = created
+		}
+		res = append(res, created.collectors...)
 	}
-	if include_basic_metrics {
-		includeMetricsRegexes = append(includeMetricsRegexes, includeBasicMetricsRegexes...)
+	return res, nil
+}
+
+func printRootCollectors() {
+	for _, factory := range collector.Registry.Factories() {
+		var roots []string
+		if created, ok := rootCollectors[factory.Name]; ok {
+			for _, col := range created.collectors {
+				roots = append(roots, col.String())
+			}
+		}
+		status := "disabled"
+		if len(roots) > 0 {
+			status = "root collectors: " + strings.Join(roots, ", ")
+		}
+		fmt.Printf("%v: %v (%v)\n", factory.Name, factory.Description, status)
+		params := collectorParameters(factory.Name)
+		for _, param := range factory.Parameters {
+			value, ok := params[param.Name]
+			if !ok {
+				value = param.Default
+			}
+			fmt.Printf("    %v (%v, default %q, current %q): %v\n", param.Name, param.Type, param.Default, value, param.Description)
+		}
+	}
+}
+
+// configureSource applies the values of the global configuration variables to the given source.
+func configureSource(source *collector.SampleSource) error {
+	if err := validateIntervals([]namedInterval{
+		{"collect_interval", collect_local_interval},
+		{"sink_interval", sink_interval},
+		{"proc_interval", proc_update_pids},
+	}, update_workers); err != nil {
+		return err
+	}
+	if tagged_samples && (pin_header_file != "" || pin_first_header) {
+		// Also checked by SampleSource.Start(), but the configuration can change at runtime
+		return fmt.Errorf("A pinned header (-pin-header, -pin-first-header) is not supported together with tagged samples (-tagged)")
+	}
+	include, exclude, err := metricFilters()
+	if err != nil {
+		return err
 	}
-	for _, exclude := range user_exclude_metrics {
-		regex, err := regexp.Compile(exclude)
+	psutil.PidUpdateInterval = proc_update_pids
+	// Rings of collectors with hanging updates might still be flushed, so the length is only changed once
+	ringLength := int(float64(ringFactory.Interval) / float64(collect_local_interval) * 10) // Make sure enough samples can be buffered
+	if windowLength := int(collector.MaxMetricWindow(metricWindows)/collect_local_interval) + 2; windowLength > ringLength {
+		ringLength = windowLength // Keep enough values for the longest window
+	}
+	if ringLength <= 0 {
+		ringLength = 1
+	}
+	ringFactory.SetLength(ringLength)
+	roots, err := createRootCollectors()
+	if err != nil {
+		return err
+	}
+	if err := multiProcApi.setCollectors(roots); err != nil {
+		return err
+	}
+
+	source.RootCollectors = roots
+	source.UpdateFrequencies = updateFrequencies
+	source.UpdateTimeout = update_timeout
+	source.UpdateWorkers = update_workers
+	source.RetryPolicy = retryPolicy
+	source.RetryPolicies = retryPolicies
+	source.CollectInterval = collect_local_interval
+	source.SinkInterval = sink_interval
+	source.ExcludeMetrics = exclude
+	source.IncludeMetrics = include
+	source.DisabledCollectors = disabled_collectors
+	source.DisabledCollectorRegexes = nil
+	for _, str := range disabled_regexes {
+		regex, err := regexp.Compile(str)
 		if err != nil {
-			golib.Checkerr(fmt.Errorf("Error compiling exclude regex: %v", err))
+			return fmt.Errorf("Error compiling disabled collector regex: %v", err)
 		}
-		excludeMetricsRegexes = append(excludeMetricsRegexes, regex)
+		source.DisabledCollectorRegexes = append(source.DisabledCollectorRegexes, regex)
 	}
-	for _, include := range user_include_metrics {
-		regex, err := regexp.Compile(include)
+	source.TaggedSamples = tagged_samples
+	source.SelfMonitoring = self_monitoring
+	source.ConsistentSnapshots = consistent_snapshots
+	source.AlignSinkTicks = align_sink_ticks
+	source.TagMeasurementTime = tag_measurement_time
+	source.MissingValuesAsNaN = missing_as_nan
+	source.MetricWindows = metricWindows
+	source.PinFirstHeader = pin_first_header
+	if pin_header_file != "" {
+		fields, err := readHeaderFile(pin_header_file)
 		if err != nil {
-			golib.Checkerr(fmt.Errorf("Error compiling include regex: %v", err))
+			return err
+		}
+		source.PinnedHeader = fields
+	} else if !pin_first_header {
+		source.PinnedHeader = nil
+	} // Otherwise, keep the header that has already been pinned
+	return configureSpool(source)
+}
+
+// configureSpool creates the spool when the spool directory has changed. The limits of an existing spool are updated.
+func configureSpool(source *collector.SampleSource) error {
+	maxBytes := int64(spool_size_mb) * 1024 * 1024
+	if source.Spool != nil {
+		if source.Spool.Dir == spool_dir {
+			source.Spool.MaxBytes = maxBytes
+			source.Spool.MaxAge = spool_max_age
+			return nil
 		}
-		includeMetricsRegexes = append(includeMetricsRegexes, regex)
+		source.Spool.Close()
+		source.Spool = nil
 	}
+	if spool_dir == "" {
+		return nil
+	}
+	spool, err := collector.NewSpool(spool_dir, maxBytes, spool_max_age)
+	if err != nil {
+		return err
+	}
+	source.Spool = spool
+	return nil
+}
 
-	source := &collector.SampleSource{
-		RootCollectors:                 cols,
-		UpdateFrequencies:              updateFrequencies,
-		CollectInterval:                collect_local_interval,
-		SinkInterval:                   sink_interval,
-		ExcludeMetrics:                 excludeMetricsRegexes,
-		IncludeMetrics:                 includeMetricsRegexes,
-		DisabledCollectors:             disabled_collectors,
-		FailedCollectorCheckInterval:   FailedCollectorCheckInterval,
-		FilteredCollectorCheckInterval: FilteredCollectorCheckInterval,
+// readHeaderFile reads a list of fields, one per line. Empty lines and lines starting with # are ignored.
+func readHeaderFile(filename string) ([]string, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read header file: %v", err)
 	}
-	helper.RestApis = append(helper.RestApis, &AvailableMetricsApi{Source: source})
-	return source
+	var fields []string
+	unique := make(map[string]bool)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || unique[line] {
+			continue
+		}
+		unique[line] = true
+		fields = append(fields, line)
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("Header file %v does not contain any fields", filename)
+	}
+	return fields, nil
+}
+
+func metricFilters() (include []*regexp.Regexp, exclude []*regexp.Regexp, err error) {
+	include = append(include, includeMetricsRegexes...)
+	if !all_metrics {
+		exclude = append(exclude, excludeMetricsRegexes...)
+	}
+	if include_basic_metrics {
+		include = append(include, includeBasicMetricsRegexes...)
+	}
+	for _, str := range user_exclude_metrics {
+		regex, compileErr := regexp.Compile(str)
+		if compileErr != nil {
+			return nil, nil, fmt.Errorf("Error compiling exclude regex: %v", compileErr)
+		}
+		exclude = append(exclude, regex)
+	}
+	for _, str := range user_include_metrics {
+		regex, compileErr := regexp.Compile(str)
+		if compileErr != nil {
+			return nil, nil, fmt.Errorf("Error compiling include regex: %v", compileErr)
+		}
+		include = append(include, regex)
+	}
+	return
 }
 
 type AvailableMetricsApi struct {
@@ -147,24 +368,232 @@ type AvailableMetricsApi struct {
 func (api *AvailableMetricsApi) Register(rootPath string, router *mux.Router) {
 	router.HandleFunc(rootPath+"/metrics", api.handleGetMetrics).Methods("GET")
 	router.HandleFunc(rootPath+"/freq", api.handleGetFrequency).Methods("GET")
+	router.HandleFunc(rootPath+"/freq", api.handleSetFrequency).Methods("POST", "PUT", "DELETE")
+	router.HandleFunc(rootPath+"/collectors", api.handleGetCollectors).Methods("GET")
+	router.HandleFunc(rootPath+"/scheduler", api.handleGetScheduler).Methods("GET")
+	router.HandleFunc(rootPath+"/graph", api.handleGetGraph).Methods("GET")
+	router.HandleFunc(rootPath+"/graph/dot", api.handleGetGraphDot).Methods("GET")
+	router.HandleFunc(rootPath+"/reload", api.handleReload).Methods("POST")
+	router.HandleFunc(rootPath+"/prometheus", api.handleGetPrometheus).Methods("GET")
+	api.registerMetricFilters(rootPath, router)
+	api.registerDisabledCollectors(rootPath, router)
+}
+
+type metricDescription struct {
+	Name string `json:"name"`
+	*collector.MetricMetadata
 }
 
 func (api *AvailableMetricsApi) handleGetMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.FormValue("metadata") == "" {
+		var out bytes.Buffer
+		for _, name := range api.Source.CurrentMetrics() {
+			out.WriteString(name + "\n")
+		}
+		w.Write(out.Bytes())
+		return
+	}
+
+	// Unknown metadata is omitted, instead of reporting default values
+	metadata := api.Source.CurrentMetadata()
+	names := api.Source.CurrentMetrics()
+	data := make([]metricDescription, len(names))
+	for i, name := range names {
+		data[i].Name = name
+		if meta, ok := metadata[name]; ok {
+			data[i].MetricMetadata = &meta
+		}
+	}
+	writeJson(w, data, "metric metadata")
+}
+
+type frequencyStatus struct {
+	Collect           string            `json:"collect"`
+	Sink              string            `json:"sink"`
+	UpdateFrequencies map[string]string `json:"update_frequencies"`
+}
+
+func (api *AvailableMetricsApi) handleGetFrequency(w http.ResponseWriter, r *http.Request) {
+	writeFrequencies(w, nil)
+}
+
+func writeFrequencies(w http.ResponseWriter, err error) {
+	if writeConfigError(w, err, "frequencies") {
+		return
+	}
+	configLock.Lock()
+	data := frequencyStatus{
+		Collect:           collect_local_interval.String(),
+		Sink:              sink_interval.String(),
+		UpdateFrequencies: make(map[string]string, len(updateFrequencies)),
+	}
+	for regex, freq := range updateFrequencies {
+		data.UpdateFrequencies[regex.String()] = freq.String()
+	}
+	configLock.Unlock()
+	writeJson(w, data, "frequency data")
+}
+
+// handleSetFrequency changes the intervals given in the 'collect' and 'sink' URL parameters, and the update frequency ('freq')
+// of the collectors matching the 'collector' regex. DELETE removes the update frequency of the 'collector' regex.
+// The metric collection is restarted with the new intervals.
+func (api *AvailableMetricsApi) handleSetFrequency(w http.ResponseWriter, r *http.Request) {
+	parseDuration := func(param string) (time.Duration, bool) {
+		str := r.FormValue(param)
+		if str == "" {
+			return 0, true
+		}
+		val, err := time.ParseDuration(str)
+		if err != nil || val <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(fmt.Sprintf("URL parameter '%v' must be a positive duration (have '%v')\n", param, str)))
+			return 0, false
+		}
+		return val, true
+	}
+	collect, ok := parseDuration("collect")
+	if !ok {
+		return
+	}
+	sink, ok := parseDuration("sink")
+	if !ok {
+		return
+	}
+	freq, ok := parseDuration("freq")
+	if !ok {
+		return
+	}
+	collectorStr := r.FormValue("collector")
+	var collectorRegex *regexp.Regexp
+	if collectorStr != "" {
+		var err error
+		if collectorRegex, err = regexp.Compile(collectorStr); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(fmt.Sprintf("Error compiling collector regex: %v\n", err)))
+			return
+		}
+	}
+	if r.Method == "DELETE" && collectorRegex == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("Missing URL parameter 'collector'\n"))
+		return
+	} else if r.Method != "DELETE" && (collectorRegex == nil) != (freq == 0) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("The URL parameters 'collector' and 'freq' must be given together\n"))
+		return
+	} else if r.Method != "DELETE" && collect == 0 && sink == 0 && freq == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("Missing URL parameters 'collect', 'sink' or 'collector' and 'freq'\n"))
+		return
+	}
+
+	err := api.modifyConfig(func() error {
+		if collect > 0 {
+			collect_local_interval = collect
+		}
+		if sink > 0 {
+			sink_interval = sink
+		}
+		if collectorRegex != nil {
+			// Replace an existing entry with the same regex
+			for regex := range updateFrequencies {
+				if regex.String() == collectorRegex.String() {
+					delete(updateFrequencies, regex)
+				}
+			}
+			if r.Method != "DELETE" {
+				updateFrequencies[collectorRegex] = freq
+			}
+		}
+		log.Printf("Changed frequencies through the REST API: collect %v, sink %v, %v collector update frequencies",
+			collect_local_interval, sink_interval, len(updateFrequencies))
+		return nil
+	})
+	writeFrequencies(w, err)
+}
+
+func (api *AvailableMetricsApi) handleGetCollectors(w http.ResponseWriter, r *http.Request) {
+	stats := api.Source.CollectorStatistics()
+	if state := collector.CollectorState(r.FormValue("state")); state != "" {
+		// For example, ?state=failed lists the failed collectors including their retry state
+		filtered := make([]collector.CollectorStatistics, 0, len(stats))
+		for _, stat := range stats {
+			if stat.State == state {
+				filtered = append(filtered, stat)
+			}
+		}
+		stats = filtered
+	}
+	writeJson(w, stats, "collector statistics")
+}
+
+func (api *AvailableMetricsApi) handleGetScheduler(w http.ResponseWriter, r *http.Request) {
+	stats := api.Source.SchedulerStatistics()
+	if stats == nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("Collectors are not updated by a pool of workers (-update-workers)\n"))
+		return
+	}
+	writeJson(w, stats, "scheduler statistics")
+}
+
+func (api *AvailableMetricsApi) handleGetGraph(w http.ResponseWriter, r *http.Request) {
+	graph, err := api.Source.CollectorGraph()
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(err.Error() + "\n"))
+		return
+	}
+	writeJson(w, graph, "collector graph")
+}
+
+func (api *AvailableMetricsApi) handleGetGraphDot(w http.ResponseWriter, r *http.Request) {
+	dotData, err := api.Source.CollectorGraphDOT()
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(err.Error() + "\n"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/vnd.graphviz")
+	w.Write(dotData)
+	w.Write([]byte{'\n'})
+}
+
+// handleGetPrometheus serves the most recent sample for scraping by Prometheus, if enabled through -prometheus.
+// The endpoint is always registered, because it can be enabled when the config file is reloaded.
+func (api *AvailableMetricsApi) handleGetPrometheus(w http.ResponseWriter, r *http.Request) {
+	configLock.Lock()
+	enabled, prefix := prometheus_enabled, prometheus_prefix
+	configLock.Unlock()
+	if !enabled {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("The Prometheus endpoint is disabled (-prometheus)\n"))
+		return
+	}
 	var out bytes.Buffer
-	for _, name := range api.Source.CurrentMetrics() {
-		out.WriteString(name + "\n")
+	if err := api.Source.WritePrometheus(&out, prefix); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("Failed to format metrics: " + err.Error() + "\n"))
+		return
 	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
 	w.Write(out.Bytes())
 }
 
-func (api *AvailableMetricsApi) handleGetFrequency(w http.ResponseWriter, r *http.Request) {
-	data := map[string]string{
-		"collect": api.Source.CollectInterval.String(),
-		"sink":    api.Source.SinkInterval.String(),
+func (api *AvailableMetricsApi) handleReload(w http.ResponseWriter, r *http.Request) {
+	if err := reloadConfig(api.Source); err != nil {
+		log.Errorln("Failed to reload configuration:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("Error: " + err.Error() + "\n"))
+		return
 	}
+	w.Write([]byte("Configuration reloaded\n"))
+}
+
+func writeJson(w http.ResponseWriter, data interface{}, description string) {
 	out, err := json.Marshal(data)
 	if err != nil {
-		log.Errorln("Error marshalling frequency data:", err)
+		log.Errorln("Error marshalling "+description+":", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte("Error: " + err.Error()))
 	} else {
@@ -12,7 +12,6 @@ import (
 	"github.com/antongulenko/golib"
 	"github.com/bitflow-stream/go-bitflow-collector"
 	"github.com/bitflow-stream/go-bitflow-collector/psutil"
-	"github.com/bitflow-stream/go-bitflow/cmd"
 	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
 )
@@ -27,16 +26,17 @@ func init() {
 	multiProcApi.RegisterFlags()
 }
 
-func createProcessCollectors(helper *cmd.CmdDataCollector) []collector.Collector {
-	psutilRoot := psutil.NewPsutilRootCollector(&ringFactory)
-	psutilProcesses := psutilRoot.NewMultiProcessCollector("processes")
-	multiProcApi.procs = psutilProcesses
-	if err := multiProcApi.updateCollectors(); err != nil {
-		golib.Checkerr(err)
+// setCollectors looks up the process collector in the given root collectors and applies the configured process groups.
+func (api *MonitorProcessesRestApi) setCollectors(roots []collector.Collector) error {
+	api.lock.Lock()
+	defer api.lock.Unlock()
+	api.procs = nil
+	for _, col := range roots {
+		if procs, ok := col.(*psutil.MultiProcessCollector); ok {
+			api.procs = procs
+		}
 	}
-	helper.RestApis = append(helper.RestApis, &multiProcApi)
-	psutil.PidUpdateInterval = proc_update_pids
-	return []collector.Collector{psutilRoot, psutilProcesses}
+	return api.updateCollectors()
 }
 
 type MonitorProcessesRestApi struct {
@@ -62,6 +62,12 @@ func (api *MonitorProcessesRestApi) Register(pathPrefix string, router *mux.Rout
 }
 
 func (api *MonitorProcessesRestApi) updateCollectors() error {
+	if api.procs == nil {
+		if len(api.proc_collectors.Keys) > 0 || len(api.proc_children_collectors.Keys) > 0 {
+			log.Warnln("Not monitoring process groups, because the psutil collector is disabled")
+		}
+		return nil
+	}
 	desc1, err := api.createCollectors(api.proc_collectors, false)
 	if err != nil {
 		return err
@@ -0,0 +1,567 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/antongulenko/golib"
+	"github.com/bitflow-stream/go-bitflow-collector"
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+)
+
+// collectorConfig is the content of the YAML or JSON file given through the -config flag.
+// Values that are not set in the file keep their defaults. Flags given on the command line override the file.
+type collectorConfig struct {
+	CollectInterval     *configDuration           `json:"collect_interval,omitempty"`
+	SinkInterval        *configDuration           `json:"sink_interval,omitempty"`
+	ProcInterval        *configDuration           `json:"proc_interval,omitempty"`
+	UpdateTimeout       *configDuration           `json:"update_timeout,omitempty"`
+	UpdateWorkers       *int                      `json:"update_workers,omitempty"`
+	UpdateFrequencies   map[string]configDuration `json:"update_frequencies,omitempty"`
+	TaggedSamples       *bool                     `json:"tagged_samples,omitempty"`
+	SelfMonitoring      *bool                     `json:"self_monitoring,omitempty"`
+	ConsistentSnapshots *bool                     `json:"consistent_snapshots,omitempty"`
+	AlignSinkTicks      *bool                     `json:"align_sink_ticks,omitempty"`
+	TagMeasurementTime  *bool                     `json:"tag_measurement_time,omitempty"`
+	MissingAsNaN        *bool                     `json:"missing_as_nan,omitempty"`
+	PinHeader           *string                   `json:"pin_header,omitempty"`
+	PinFirstHeader      *bool                     `json:"pin_first_header,omitempty"`
+	SpoolDir            *string                   `json:"spool_dir,omitempty"`
+	SpoolSizeMB         *int                      `json:"spool_size_mb,omitempty"`
+	SpoolMaxAge         *configDuration           `json:"spool_max_age,omitempty"`
+	Prometheus          *bool                     `json:"prometheus,omitempty"`
+	PrometheusPrefix    *string                   `json:"prometheus_prefix,omitempty"`
+
+	// Regex matched against metric names -> additional rate windows
+	MetricWindows map[string]metricWindowsConfig `json:"metric_windows,omitempty"`
+
+	// Default retry policy, and regex matched against collector names -> retry policy
+	RetryPolicy   retryPolicyConfig            `json:"retry_policy"`
+	RetryPolicies map[string]retryPolicyConfig `json:"retry_policies,omitempty"`
+
+	Metrics    metricsConfig                  `json:"metrics"`
+	Collectors map[string]rootCollectorConfig `json:"collectors,omitempty"`
+
+	// Names of individual collectors to disable, e.g. psutil/processes, and regexes matched against the collector names
+	DisabledCollectors       []string `json:"disabled_collectors,omitempty"`
+	DisabledCollectorRegexes []string `json:"disabled_collector_regexes,omitempty"`
+
+	// Process groups: group name -> regex matched against the command line of processes
+	Processes       map[string]string `json:"processes,omitempty"`
+	ProcessChildren map[string]string `json:"process_children,omitempty"`
+}
+
+type metricsConfig struct {
+	All     *bool    `json:"all,omitempty"`
+	Basic   *bool    `json:"basic,omitempty"`
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+type metricWindowsConfig struct {
+	Windows    []configDuration `json:"windows"`
+	Statistics bool             `json:"statistics,omitempty"`
+}
+
+type retryPolicyConfig struct {
+	ToleratedFailures *int            `json:"tolerated_failures,omitempty"`
+	BackoffBase       *configDuration `json:"backoff_base,omitempty"`
+	BackoffMax        *configDuration `json:"backoff_max,omitempty"`
+	Jitter            *float64        `json:"jitter,omitempty"`
+}
+
+func (config retryPolicyConfig) validate(name string) error {
+	if config.Jitter != nil && (*config.Jitter < 0 || *config.Jitter > 1) {
+		return fmt.Errorf("Invalid retry jitter for %v: %v (must be between 0 and 1)", name, *config.Jitter)
+	}
+	return nil
+}
+
+// policy converts the configuration, leaving unset values at zero so that the defaults of the SampleSource are used
+func (config retryPolicyConfig) policy() (policy collector.RetryPolicy) {
+	if config.ToleratedFailures != nil {
+		policy.ToleratedFailures = *config.ToleratedFailures
+	}
+	if config.BackoffBase != nil {
+		policy.BackoffBase = time.Duration(*config.BackoffBase)
+	}
+	if config.BackoffMax != nil {
+		policy.BackoffMax = time.Duration(*config.BackoffMax)
+	}
+	if config.Jitter != nil {
+		policy.Jitter = *config.Jitter
+	}
+	return
+}
+
+type rootCollectorConfig struct {
+	Enabled    *bool             `json:"enabled,omitempty"`
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+type configDuration time.Duration
+
+func (d configDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *configDuration) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+	dur, err := time.ParseDuration(str)
+	*d = configDuration(dur)
+	return err
+}
+
+var (
+	// Enabled state and parameters of the collectors in collector.Registry, as given in the config file
+	collectorConfigs = make(map[string]rootCollectorConfig)
+
+	// Collectors in collector.Registry enabled through the command line, e.g. the collectors of plugins that are disabled by default
+	enabled_collectors golib.StringSlice
+
+	// Parameters of the collectors in collector.Registry in the form collector.parameter=value
+	collector_params golib.StringSlice
+
+	// Command line flags that set parameters of collectors in collector.Registry
+	parameterFlags = []struct {
+		flag, collector, parameter string
+		value                      func() string
+	}{
+		{"libvirt", "libvirt", "uri", func() string { return libvirt_uri }},
+		{"ovsdb", "ovsdb", "host", func() string { return ovsdb_host }},
+		{"nic", "psutil", "pcap_nics", func() string { return strings.Join(pcap_nics, ",") }},
+	}
+)
+
+func init() {
+	flag.Var(&enabled_collectors, "enable-collector", "Enable the given collector, overriding the config file. "+
+		"Required for collectors loaded through -collector-plugin, unless they are enabled in the config file. Can be given multiple times.")
+	flag.Var(&collector_params, "collector-param", "'collector.parameter=value' Set a parameter of a collector, overriding the config file "+
+		"(see -print-root-collectors). Can be given multiple times.")
+}
+
+func collectorEnabled(name string) bool {
+	for _, enabled := range enabled_collectors {
+		if enabled == name {
+			return true
+		}
+	}
+	if enabled := collectorConfigs[name].Enabled; enabled != nil {
+		return *enabled
+	}
+	factory := collector.Registry.Get(name)
+	return factory == nil || !factory.DisabledByDefault
+}
+
+// collectorParameters returns the parameters for the given registered collector, taking command line flags into account.
+func collectorParameters(name string) map[string]string {
+	res := make(map[string]string)
+	for key, val := range collectorConfigs[name].Parameters {
+		res[key] = val
+	}
+	for _, param := range collector_params {
+		if col, key, val, err := parseCollectorParam(param); err == nil && col == name {
+			res[key] = val
+		}
+	}
+	overridden := setFlags()
+	for _, param := range parameterFlags {
+		if param.collector == name && overridden[param.flag] {
+			res[param.parameter] = param.value()
+		}
+	}
+	return res
+}
+
+func parseCollectorParam(param string) (col, key, val string, err error) {
+	assignment := strings.SplitN(param, "=", 2)
+	name := strings.SplitN(assignment[0], ".", 2)
+	if len(assignment) != 2 || len(name) != 2 || name[0] == "" || name[1] == "" {
+		err = fmt.Errorf("Invalid collector parameter '%v', expected the form collector.parameter=value", param)
+		return
+	}
+	return name[0], name[1], assignment[1], nil
+}
+
+// validateCollectorFlags checks the collectors and parameters given through -enable-collector and -collector-param.
+// Must be called after loading the plugins.
+func validateCollectorFlags() error {
+	for _, name := range enabled_collectors {
+		if collector.Registry.Get(name) == nil {
+			return fmt.Errorf("Unknown collector '%v' (-enable-collector)", name)
+		}
+	}
+	for _, param := range collector_params {
+		name, key, _, err := parseCollectorParam(param)
+		if err != nil {
+			return err
+		}
+		factory := collector.Registry.Get(name)
+		if factory == nil {
+			return fmt.Errorf("Unknown collector '%v' (-collector-param)", name)
+		}
+		known := false
+		for _, factoryParam := range factory.Parameters {
+			known = known || factoryParam.Name == key
+		}
+		if !known {
+			return fmt.Errorf("Unknown parameter '%v' for collector '%v' (-collector-param)", key, name)
+		}
+	}
+	return nil
+}
+
+func loadConfigFile(filename string) error {
+	config, err := readConfigFile(filename)
+	if err != nil {
+		return err
+	}
+	config.apply(setFlags())
+	log.Println("Loaded configuration from", filename)
+	return nil
+}
+
+func readConfigFile(filename string) (*collectorConfig, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var config collectorConfig
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("Failed to parse config file %v: %v", filename, err)
+	}
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("Invalid config file %v: %v", filename, err)
+	}
+	return &config, nil
+}
+
+// setFlags returns the names of all flags that have been set on the command line
+func setFlags() map[string]bool {
+	res := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		res[f.Name] = true
+	})
+	return res
+}
+
+func (config *collectorConfig) validate() error {
+	var intervals []namedInterval
+	for _, interval := range []struct {
+		name string
+		val  *configDuration
+	}{
+		{"collect_interval", config.CollectInterval},
+		{"sink_interval", config.SinkInterval},
+		{"proc_interval", config.ProcInterval},
+	} {
+		if interval.val != nil {
+			intervals = append(intervals, namedInterval{interval.name, time.Duration(*interval.val)})
+		}
+	}
+	workers := 0
+	if config.UpdateWorkers != nil {
+		workers = *config.UpdateWorkers
+	}
+	if err := validateIntervals(intervals, workers); err != nil {
+		return err
+	}
+	for name, col := range config.Collectors {
+		factory := collector.Registry.Get(name)
+		if factory == nil {
+			return fmt.Errorf("Unknown collector '%v'", name)
+		}
+		if _, err := factory.ParseParameters(col.Parameters); err != nil {
+			return err
+		}
+	}
+	for name := range config.UpdateFrequencies {
+		if _, err := regexp.Compile(name); err != nil {
+			return fmt.Errorf("Error compiling update frequency regex: %v", err)
+		}
+	}
+	for name, windows := range config.MetricWindows {
+		if _, err := regexp.Compile(name); err != nil {
+			return fmt.Errorf("Error compiling metric window regex: %v", err)
+		}
+		for _, window := range windows.Windows {
+			if window <= 0 {
+				return fmt.Errorf("Invalid metric window for %v: %v", name, time.Duration(window))
+			}
+		}
+	}
+	if err := config.RetryPolicy.validate("the default retry policy"); err != nil {
+		return err
+	}
+	for name, policy := range config.RetryPolicies {
+		if _, err := regexp.Compile(name); err != nil {
+			return fmt.Errorf("Error compiling retry policy regex: %v", err)
+		}
+		if err := policy.validate(name); err != nil {
+			return err
+		}
+	}
+	for _, regexes := range [][]string{config.Metrics.Include, config.Metrics.Exclude} {
+		for _, str := range regexes {
+			if _, err := regexp.Compile(str); err != nil {
+				return fmt.Errorf("Error compiling metric filter regex: %v", err)
+			}
+		}
+	}
+	for _, str := range config.DisabledCollectorRegexes {
+		if _, err := regexp.Compile(str); err != nil {
+			return fmt.Errorf("Error compiling disabled collector regex: %v", err)
+		}
+	}
+	return nil
+}
+
+type namedInterval struct {
+	name string
+	val  time.Duration
+}
+
+// validateIntervals checks settings that would otherwise only be rejected when the collection is started for the first time.
+// The names of the intervals are those of the config file.
+func validateIntervals(intervals []namedInterval, updateWorkers int) error {
+	for _, interval := range intervals {
+		if interval.val <= 0 {
+			return fmt.Errorf("The %v must be positive (have %v)", interval.name, interval.val)
+		}
+	}
+	if updateWorkers < 0 {
+		return fmt.Errorf("The update_workers must not be negative (have %v)", updateWorkers)
+	}
+	return nil
+}
+
+// apply copies the configuration into the global variables, except for the values that are overridden by the given flags.
+func (config *collectorConfig) apply(overriddenFlags map[string]bool) {
+
+	setDuration := func(flagName string, target *time.Duration, val *configDuration) {
+		if val != nil && !overriddenFlags[flagName] {
+			*target = time.Duration(*val)
+		}
+	}
+	setString := func(flagName string, target *string, val *string) {
+		if val != nil && !overriddenFlags[flagName] {
+			*target = *val
+		}
+	}
+	setInt := func(flagName string, target *int, val *int) {
+		if val != nil && !overriddenFlags[flagName] {
+			*target = *val
+		}
+	}
+	setFloat := func(flagName string, target *float64, val *float64) {
+		if val != nil && !overriddenFlags[flagName] {
+			*target = *val
+		}
+	}
+	setBool := func(flagName string, target *bool, val *bool) {
+		if val != nil && !overriddenFlags[flagName] {
+			*target = *val
+		}
+	}
+	setStrings := func(flagName string, target *golib.StringSlice, val []string) {
+		if val != nil && !overriddenFlags[flagName] {
+			*target = val
+		}
+	}
+	setProcesses := func(flagName string, target *golib.KeyValueStringSlice, val map[string]string) {
+		if val != nil && !overriddenFlags[flagName] {
+			// The process groups are also modified through the /proc REST API
+			multiProcApi.lock.Lock()
+			defer multiProcApi.lock.Unlock()
+			*target = golib.KeyValueStringSlice{}
+			for key, regex := range val {
+				target.Put(key, regex)
+			}
+		}
+	}
+
+	setDuration("ci", &collect_local_interval, config.CollectInterval)
+	setDuration("si", &sink_interval, config.SinkInterval)
+	setDuration("proc-interval", &proc_update_pids, config.ProcInterval)
+	setDuration("update-timeout", &update_timeout, config.UpdateTimeout)
+	setInt("update-workers", &update_workers, config.UpdateWorkers)
+	setInt("tolerated-failures", &retryPolicy.ToleratedFailures, config.RetryPolicy.ToleratedFailures)
+	setDuration("retry-backoff", &retryPolicy.BackoffBase, config.RetryPolicy.BackoffBase)
+	setDuration("retry-backoff-max", &retryPolicy.BackoffMax, config.RetryPolicy.BackoffMax)
+	setFloat("retry-jitter", &retryPolicy.Jitter, config.RetryPolicy.Jitter)
+	setBool("tagged", &tagged_samples, config.TaggedSamples)
+	setBool("self-monitoring", &self_monitoring, config.SelfMonitoring)
+	setBool("consistent", &consistent_snapshots, config.ConsistentSnapshots)
+	setBool("align", &align_sink_ticks, config.AlignSinkTicks)
+	setBool("tag-measurement-time", &tag_measurement_time, config.TagMeasurementTime)
+	setBool("nan", &missing_as_nan, config.MissingAsNaN)
+	setString("pin-header", &pin_header_file, config.PinHeader)
+	setBool("pin-first-header", &pin_first_header, config.PinFirstHeader)
+	setString("spool", &spool_dir, config.SpoolDir)
+	setInt("spool-size", &spool_size_mb, config.SpoolSizeMB)
+	setDuration("spool-age", &spool_max_age, config.SpoolMaxAge)
+	setBool("prometheus", &prometheus_enabled, config.Prometheus)
+	setString("prometheus-prefix", &prometheus_prefix, config.PrometheusPrefix)
+	setBool("a", &all_metrics, config.Metrics.All)
+	setBool("basic", &include_basic_metrics, config.Metrics.Basic)
+	setStrings("include", &user_include_metrics, config.Metrics.Include)
+	setStrings("exclude", &user_exclude_metrics, config.Metrics.Exclude)
+	setStrings("disable", &disabled_collectors, config.DisabledCollectors)
+	setStrings("disable-regex", &disabled_regexes, config.DisabledCollectorRegexes)
+	setProcesses("proc", &multiProcApi.proc_collectors, config.Processes)
+	setProcesses("proc-children", &multiProcApi.proc_children_collectors, config.ProcessChildren)
+
+	// Update frequencies have no corresponding flag. Entries with the same regex replace the built-in values.
+	for name, freq := range config.UpdateFrequencies {
+		for regex := range updateFrequencies {
+			if regex.String() == name {
+				delete(updateFrequencies, regex)
+			}
+		}
+		updateFrequencies[regexp.MustCompile(name)] = time.Duration(freq)
+	}
+
+	// Metric windows have no corresponding flag and replace the previous configuration entirely
+	if config.MetricWindows != nil {
+		metricWindows = make(map[*regexp.Regexp]collector.MetricWindows, len(config.MetricWindows))
+		for name, windows := range config.MetricWindows {
+			converted := collector.MetricWindows{Statistics: windows.Statistics}
+			for _, window := range windows.Windows {
+				converted.Windows = append(converted.Windows, time.Duration(window))
+			}
+			metricWindows[regexp.MustCompile(name)] = converted
+		}
+	}
+
+	// Retry policies have no corresponding flag and replace the previous configuration entirely
+	if config.RetryPolicies != nil {
+		retryPolicies = make(map[*regexp.Regexp]collector.RetryPolicy, len(config.RetryPolicies))
+		for name, policy := range config.RetryPolicies {
+			retryPolicies[regexp.MustCompile(name)] = policy.policy()
+		}
+	}
+
+	for name, col := range config.Collectors {
+		current := collectorConfigs[name]
+		if col.Enabled != nil {
+			current.Enabled = col.Enabled
+		}
+		if col.Parameters != nil {
+			params := make(map[string]string, len(current.Parameters)+len(col.Parameters))
+			for key, val := range current.Parameters {
+				params[key] = val
+			}
+			for key, val := range col.Parameters {
+				params[key] = val
+			}
+			current.Parameters = params
+		}
+		collectorConfigs[name] = current
+	}
+}
+
+// currentConfig returns the effective configuration, after applying the config file and the command line flags
+func currentConfig() *collectorConfig {
+	duration := func(val time.Duration) *configDuration {
+		res := configDuration(val)
+		return &res
+	}
+	boolean := func(val bool) *bool {
+		return &val
+	}
+	integer := func(val int) *int {
+		return &val
+	}
+	str := func(val string) *string {
+		return &val
+	}
+	retry := func(policy collector.RetryPolicy) retryPolicyConfig {
+		return retryPolicyConfig{
+			ToleratedFailures: integer(policy.ToleratedFailures),
+			BackoffBase:       duration(policy.BackoffBase),
+			BackoffMax:        duration(policy.BackoffMax),
+			Jitter:            &policy.Jitter,
+		}
+	}
+	config := &collectorConfig{
+		CollectInterval:     duration(collect_local_interval),
+		SinkInterval:        duration(sink_interval),
+		ProcInterval:        duration(proc_update_pids),
+		UpdateTimeout:       duration(update_timeout),
+		UpdateWorkers:       integer(update_workers),
+		UpdateFrequencies:   make(map[string]configDuration, len(updateFrequencies)),
+		MetricWindows:       make(map[string]metricWindowsConfig, len(metricWindows)),
+		RetryPolicy:         retry(retryPolicy),
+		RetryPolicies:       make(map[string]retryPolicyConfig, len(retryPolicies)),
+		TaggedSamples:       boolean(tagged_samples),
+		SelfMonitoring:      boolean(self_monitoring),
+		ConsistentSnapshots: boolean(consistent_snapshots),
+		AlignSinkTicks:      boolean(align_sink_ticks),
+		TagMeasurementTime:  boolean(tag_measurement_time),
+		MissingAsNaN:        boolean(missing_as_nan),
+		PinHeader:           str(pin_header_file),
+		PinFirstHeader:      boolean(pin_first_header),
+		SpoolDir:            str(spool_dir),
+		SpoolSizeMB:         integer(spool_size_mb),
+		SpoolMaxAge:         duration(spool_max_age),
+		Prometheus:          boolean(prometheus_enabled),
+		PrometheusPrefix:    str(prometheus_prefix),
+		Metrics: metricsConfig{
+			All:     boolean(all_metrics),
+			Basic:   boolean(include_basic_metrics),
+			Include: append([]string{}, user_include_metrics...),
+			Exclude: append([]string{}, user_exclude_metrics...),
+		},
+		Collectors:               make(map[string]rootCollectorConfig),
+		DisabledCollectors:       append([]string{}, disabled_collectors...),
+		DisabledCollectorRegexes: append([]string{}, disabled_regexes...),
+	}
+	multiProcApi.lock.Lock()
+	config.Processes = multiProcApi.proc_collectors.Map()
+	config.ProcessChildren = multiProcApi.proc_children_collectors.Map()
+	multiProcApi.lock.Unlock()
+	for regex, freq := range updateFrequencies {
+		config.UpdateFrequencies[regex.String()] = configDuration(freq)
+	}
+	for regex, windows := range metricWindows {
+		converted := metricWindowsConfig{Statistics: windows.Statistics}
+		for _, window := range windows.Windows {
+			converted.Windows = append(converted.Windows, configDuration(window))
+		}
+		config.MetricWindows[regex.String()] = converted
+	}
+	for regex, policy := range retryPolicies {
+		config.RetryPolicies[regex.String()] = retry(policy)
+	}
+	for _, factory := range collector.Registry.Factories() {
+		col := rootCollectorConfig{Enabled: boolean(collectorEnabled(factory.Name))}
+		if len(factory.Parameters) > 0 {
+			col.Parameters = collectorParameters(factory.Name)
+			for _, param := range factory.Parameters {
+				if _, ok := col.Parameters[param.Name]; !ok && !param.Required {
+					col.Parameters[param.Name] = param.Default
+				}
+			}
+		}
+		config.Collectors[factory.Name] = col
+	}
+	return config
+}
+
+func dumpConfig() error {
+	data, err := yaml.Marshal(currentConfig())
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(data))
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/gorilla/mux"
+)
+
+// disabledCollectorsStatus lists the collectors that are disabled through -disable and -disable-regex, or the REST API.
+// Changes through the REST API are reset when the config file is reloaded.
+type disabledCollectorsStatus struct {
+	Names   []string `json:"names"`
+	Regexes []string `json:"regexes"`
+}
+
+func (api *AvailableMetricsApi) registerDisabledCollectors(rootPath string, router *mux.Router) {
+	router.HandleFunc(rootPath+"/disable", api.handleDisableCollector).Methods("GET", "POST", "PUT", "DELETE")
+}
+
+func currentDisabledCollectors() disabledCollectorsStatus {
+	configLock.Lock()
+	defer configLock.Unlock()
+	return disabledCollectorsStatus{
+		Names:   append([]string{}, disabled_collectors...),
+		Regexes: append([]string{}, disabled_regexes...),
+	}
+}
+
+// handleDisableCollector disables (POST, PUT) or enables (DELETE) the collectors given by the exact 'name' or the 'regex' URL parameter.
+// Nested collectors are matched as well, e.g. name=psutil/net-proto or regex=^libvirt/vm1/.
+func (api *AvailableMetricsApi) handleDisableCollector(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "GET" {
+		writeDisabledCollectors(w, nil)
+		return
+	}
+	if name := r.FormValue("name"); name != "" {
+		api.changeList(w, r, "disabled collector", name, &disabled_collectors, writeDisabledCollectors)
+	} else if regexStr := r.FormValue("regex"); regexStr != "" {
+		if _, err := regexp.Compile(regexStr); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(fmt.Sprintf("Error compiling collector regex: %v\n", err)))
+			return
+		}
+		api.changeList(w, r, "disabled collector regex", regexStr, &disabled_regexes, writeDisabledCollectors)
+	} else {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("Missing URL parameter 'name' or 'regex'\n"))
+	}
+}
+
+func writeDisabledCollectors(w http.ResponseWriter, err error) {
+	if !writeConfigError(w, err, "disabled collectors") {
+		writeJson(w, currentDisabledCollectors(), "disabled collectors")
+	}
+}
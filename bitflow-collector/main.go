@@ -3,9 +3,9 @@ package main
 import (
 	"flag"
 	"os"
-	"strings"
 
 	"github.com/antongulenko/golib"
+	"github.com/bitflow-stream/go-bitflow-collector"
 	"github.com/bitflow-stream/go-bitflow/cmd"
 	log "github.com/sirupsen/logrus"
 )
@@ -16,9 +16,12 @@ func main() {
 
 func do_main() int {
 	print_metrics := flag.Bool("print-metrics", false, "Print all available metrics and exit")
-	print_root_collectors := flag.Bool("print-root-collectors", false, "Print the available root collectors and exit")
+	print_root_collectors := flag.Bool("print-root-collectors", false, "Print the registered collectors with their descriptions and parameters, and exit")
 	print_graph := flag.String("graph", "", "Create png-file for the collector-graph and exit")
 	print_graph_dot := flag.String("graph-dot", "", "Create dot-file for the collector-graph and exit")
+	dump_config := flag.Bool("dump-config", false, "Print the effective configuration in YAML format and exit")
+	var plugins golib.StringSlice
+	flag.Var(&plugins, "collector-plugin", "Go plugin (.so file) providing additional collectors. Can be given multiple times.")
 
 	// Parse command line flags
 	helper := cmd.CmdDataCollector{DefaultOutput: "box://-"}
@@ -27,6 +30,20 @@ func do_main() int {
 	if len(args) > 0 {
 		log.Fatalln("Stray command line argument(s):", args)
 	}
+	for _, path := range plugins {
+		name, err := collector.LoadPlugin(collector.Registry, path)
+		golib.Checkerr(err)
+		log.Println("Loaded collector plugin", name, "from", path)
+	}
+	golib.Checkerr(validateCollectorFlags())
+	flagConfig = currentConfig()
+	if config_file != "" {
+		golib.Checkerr(loadConfigFile(config_file))
+	}
+	if *dump_config {
+		golib.Checkerr(dumpConfig())
+		return 0
+	}
 	defer golib.ProfileCpu()()
 
 	// Configure the data collector pipeline
@@ -40,11 +57,7 @@ func do_main() int {
 	// Print requested information
 	stop := false
 	if *print_root_collectors {
-		rootNames := make([]string, len(collector.RootCollectors))
-		for i, col := range collector.RootCollectors {
-			rootNames[i] = col.String()
-		}
-		log.Println("Root collectors:", strings.Join(rootNames, ", "))
+		printRootCollectors()
 		stop = true
 	}
 	if *print_metrics {
@@ -63,5 +76,6 @@ func do_main() int {
 		return 0
 	}
 
+	reloadOnSignal(collector)
 	return p.StartAndWait()
 }
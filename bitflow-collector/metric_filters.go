@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/antongulenko/golib"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// metricFiltersStatus lists the metric filters that can be modified through the REST API.
+// Changes are reset when the config file is reloaded.
+type metricFiltersStatus struct {
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+	Basic   bool     `json:"basic"`
+	All     bool     `json:"all"`
+}
+
+func (api *AvailableMetricsApi) registerMetricFilters(rootPath string, router *mux.Router) {
+	router.HandleFunc(rootPath+"/filters", api.handleGetFilters).Methods("GET")
+	router.HandleFunc(rootPath+"/filters/include", api.handleIncludeFilter).Methods("POST", "PUT", "DELETE")
+	router.HandleFunc(rootPath+"/filters/exclude", api.handleExcludeFilter).Methods("POST", "PUT", "DELETE")
+	router.HandleFunc(rootPath+"/filters/basic", api.handleBasicFilter).Methods("POST", "PUT")
+}
+
+func currentMetricFilters() metricFiltersStatus {
+	configLock.Lock()
+	defer configLock.Unlock()
+	return metricFiltersStatus{
+		Include: append([]string{}, user_include_metrics...),
+		Exclude: append([]string{}, user_exclude_metrics...),
+		Basic:   include_basic_metrics,
+		All:     all_metrics,
+	}
+}
+
+func (api *AvailableMetricsApi) handleGetFilters(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, currentMetricFilters(), "metric filters")
+}
+
+func (api *AvailableMetricsApi) handleIncludeFilter(w http.ResponseWriter, r *http.Request) {
+	api.handleFilter("include", &user_include_metrics, w, r)
+}
+
+func (api *AvailableMetricsApi) handleExcludeFilter(w http.ResponseWriter, r *http.Request) {
+	api.handleFilter("exclude", &user_exclude_metrics, w, r)
+}
+
+// handleFilter adds (POST, PUT) or removes (DELETE) the regex given in the 'regex' URL parameter.
+func (api *AvailableMetricsApi) handleFilter(description string, filters *golib.StringSlice, w http.ResponseWriter, r *http.Request) {
+	regexStr := r.FormValue("regex")
+	if regexStr == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("Missing URL parameter 'regex'\n"))
+		return
+	}
+	if _, err := regexp.Compile(regexStr); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(fmt.Sprintf("Error compiling %v regex: %v\n", description, err)))
+		return
+	}
+	api.changeList(w, r, description+" regex", regexStr, filters, writeMetricFilters)
+}
+
+// changeList adds (POST, PUT) or removes (DELETE) the value and restarts the metric collection. Afterwards, writeStatus
+// writes the response. Adding an existing value does not restart the metric collection.
+func (api *AvailableMetricsApi) changeList(w http.ResponseWriter, r *http.Request, description string, value string,
+	list *golib.StringSlice, writeStatus func(w http.ResponseWriter, err error)) {
+
+	configLock.Lock()
+	exists := indexOf(*list, value) >= 0
+	configLock.Unlock()
+	if r.Method == "DELETE" && !exists {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(fmt.Sprintf("No %v '%v'\n", description, value)))
+		return
+	} else if r.Method != "DELETE" && exists {
+		// Nothing changed, no need to restart the metric collection
+		writeStatus(w, nil)
+		return
+	}
+
+	err := api.modifyConfig(func() error {
+		if index := indexOf(*list, value); r.Method == "DELETE" && index >= 0 {
+			*list = append((*list)[:index:index], (*list)[index+1:]...)
+			log.Printf("Removed %v '%v'", description, value)
+		} else if r.Method != "DELETE" && index < 0 {
+			*list = append(*list, value)
+			log.Printf("Added %v '%v'", description, value)
+		}
+		return nil
+	})
+	writeStatus(w, err)
+}
+
+func indexOf(slice []string, str string) int {
+	for i, existing := range slice {
+		if existing == str {
+			return i
+		}
+	}
+	return -1
+}
+
+// handleBasicFilter enables or disables the -basic preset according to the 'enabled' URL parameter.
+func (api *AvailableMetricsApi) handleBasicFilter(w http.ResponseWriter, r *http.Request) {
+	enabled, err := strconv.ParseBool(r.FormValue("enabled"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("URL parameter 'enabled' must be true or false\n"))
+		return
+	}
+	err = api.modifyConfig(func() error {
+		include_basic_metrics = enabled
+		log.Println("Including only basic metrics:", enabled)
+		return nil
+	})
+	writeMetricFilters(w, err)
+}
+
+// modifyConfig restarts the metric collection after invoking the given function, so that the changed configuration is applied.
+// If the function or applying the changed configuration fails, the previous configuration is restored.
+func (api *AvailableMetricsApi) modifyConfig(modify func() error) error {
+	var modifyErr error
+	err := api.Source.Reconfigure(func() {
+		configLock.Lock()
+		defer configLock.Unlock()
+		modifyErr = changeConfig(api.Source, modify)
+	})
+	if err == nil {
+		err = modifyErr
+	}
+	return err
+}
+
+func writeMetricFilters(w http.ResponseWriter, err error) {
+	if !writeConfigError(w, err, "metric filters") {
+		writeJson(w, currentMetricFilters(), "metric filters")
+	}
+}
+
+// writeConfigError writes the error returned by modifyConfig, if any, and returns true in that case.
+func writeConfigError(w http.ResponseWriter, err error, description string) bool {
+	if err == nil {
+		return false
+	}
+	log.Errorln("Failed to modify "+description+":", err)
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write([]byte("Error: " + err.Error() + "\n"))
+	return true
+}
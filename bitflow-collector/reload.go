@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"os/signal"
+	"regexp"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bitflow-stream/go-bitflow-collector"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	config_file string
+
+	// The configuration resulting from the default values and command line flags, without the config file
+	flagConfig *collectorConfig
+
+	// Protects the global configuration variables while they are modified at runtime, through a reload or the REST API
+	configLock sync.Mutex
+)
+
+func init() {
+	flag.StringVar(&config_file, "config", "", "YAML or JSON file with the collector configuration. Command line flags override values in the file. "+
+		"The file is reloaded on SIGHUP or through the REST API (POST /reload).")
+}
+
+func reloadOnSignal(source *collector.SampleSource) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			log.Println("Received SIGHUP, reloading configuration")
+			if err := reloadConfig(source); err != nil {
+				log.Errorln("Failed to reload configuration:", err)
+			}
+		}
+	}()
+}
+
+// reloadConfig reads the config file again and applies the resulting configuration to the running source.
+// Only the collectors affected by the changes are re-initialized.
+func reloadConfig(source *collector.SampleSource) error {
+	if config_file == "" {
+		return errors.New("No config file has been specified (-config)")
+	}
+	config, err := readConfigFile(config_file)
+	if err != nil {
+		return err
+	}
+	var configErr error
+	err = source.Reconfigure(func() {
+		configLock.Lock()
+		defer configLock.Unlock()
+		configErr = changeConfig(source, func() error {
+			// Start from the defaults and command line flags, so that values removed from the file are reset as well
+			updateFrequencies = make(map[*regexp.Regexp]time.Duration)
+			collectorConfigs = make(map[string]rootCollectorConfig)
+			flagConfig.apply(nil)
+			config.apply(setFlags())
+			return nil
+		})
+	})
+	if err == nil {
+		err = configErr
+	}
+	if err == nil {
+		log.Println("Reloaded configuration from", config_file)
+	}
+	return err
+}
+
+// changeConfig invokes the given function to modify the global configuration, and applies the result to the source.
+// If the function or applying the changed configuration fails, the previous configuration is restored. Otherwise,
+// the failed change would be picked up by the next reload or REST call. The caller must hold configLock.
+func changeConfig(source *collector.SampleSource, change func() error) error {
+	previous := currentConfig()
+	previous.Collectors = nil // Contains the effective values of all collectors, restore the explicitly configured ones instead
+	previousCollectors := make(map[string]rootCollectorConfig, len(collectorConfigs))
+	for name, col := range collectorConfigs {
+		previousCollectors[name] = col
+	}
+
+	err := change()
+	if err == nil {
+		err = configureSource(source)
+	}
+	if err != nil {
+		updateFrequencies = make(map[*regexp.Regexp]time.Duration)
+		collectorConfigs = previousCollectors
+		previous.apply(nil)
+		if restoreErr := configureSource(source); restoreErr != nil {
+			log.Errorln("Failed to restore the previous configuration:", restoreErr)
+		}
+	}
+	return err
+}
@@ -0,0 +1,228 @@
+package collector
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/antongulenko/golib"
+)
+
+// Clock abstracts the access to the current time and timers. It is used by ValueRings, the SampleSource and
+// collectors that schedule work, so that rate computations and update scheduling can be tested with a FakeClock.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is the subset of time.Timer used through a Clock. For timers created through AfterFunc, C() returns nil.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+// RealClock is the default Clock, based on the time package.
+var RealClock Clock = realClock{}
+
+func clockOrDefault(clock Clock) Clock {
+	if clock == nil {
+		return RealClock
+	}
+	return clock
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return realTimer{time.AfterFunc(d, f)}
+}
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+// waitPrecise replaces golib.StopChan.WaitTimeoutPrecise: it waits until the given interval has passed since *lastTime,
+// waking up every interval*timeoutLoopFactor to check the passed time. Afterwards, *lastTime is set to the current time.
+// False is returned if the stopper has been stopped.
+func waitPrecise(clock Clock, stopper golib.StopChan, interval time.Duration, lastTime *time.Time) bool {
+	if !waitUntil(clock, stopper, lastTime.Add(interval), interval) {
+		return false
+	}
+	*lastTime = clock.Now()
+	return !stopper.Stopped()
+}
+
+// waitAligned waits until the next multiple of the interval since the zero time, for example until the next full second.
+// Ticks that have been missed, because the caller did not return in time, are skipped. Afterwards, *tickTime is set to the
+// aligned time, instead of the current time. False is returned if the stopper has been stopped.
+func waitAligned(clock Clock, stopper golib.StopChan, interval time.Duration, tickTime *time.Time) bool {
+	next := clock.Now().Truncate(interval).Add(interval)
+	if !waitUntil(clock, stopper, next, interval) {
+		return false
+	}
+	*tickTime = next
+	return !stopper.Stopped()
+}
+
+// waitUntil waits until the given end time, waking up every interval*timeoutLoopFactor to check the passed time.
+func waitUntil(clock Clock, stopper golib.StopChan, end time.Time, interval time.Duration) bool {
+	step := time.Duration(float64(interval) * timeoutLoopFactor)
+	for {
+		remaining := end.Sub(clock.Now())
+		if remaining <= 0 {
+			break
+		}
+		if step > 0 && remaining > step {
+			remaining = step
+		}
+		timer := clock.NewTimer(remaining)
+		select {
+		case <-stopper.WaitChan():
+			timer.Stop()
+			return false
+		case <-timer.C():
+		}
+	}
+	return true
+}
+
+// FakeClock is a Clock for tests. The time only changes through Advance() and Set(), which also fire the timers
+// that have expired. Functions passed to AfterFunc() are executed synchronously inside Advance() and Set().
+type FakeClock struct {
+	lock   sync.Mutex
+	cond   *sync.Cond
+	now    time.Time
+	timers []*fakeTimer
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	clock := &FakeClock{now: now}
+	clock.cond = sync.NewCond(&clock.lock)
+	return clock
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	return c.addTimer(d, nil)
+}
+
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	return c.addTimer(d, f)
+}
+
+// Advance moves the time forward by the given duration and fires all expired timers in the order of their expiration.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Set changes the current time and fires all expired timers in the order of their expiration.
+func (c *FakeClock) Set(now time.Time) {
+	c.lock.Lock()
+	c.now = now
+	var expired, pending []*fakeTimer
+	for _, timer := range c.timers {
+		if timer.when.After(now) {
+			pending = append(pending, timer)
+		} else {
+			expired = append(expired, timer)
+		}
+	}
+	c.timers = pending
+	c.lock.Unlock()
+
+	sort.SliceStable(expired, func(i, j int) bool {
+		return expired[i].when.Before(expired[j].when)
+	})
+	for _, timer := range expired {
+		timer.fire(now)
+	}
+}
+
+// Timers returns the number of timers that have not yet expired or been stopped.
+func (c *FakeClock) Timers() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.timers)
+}
+
+// WaitForTimers blocks until at least the given number of timers are pending. This allows tests to wait until
+// background goroutines have started waiting, before advancing the time.
+func (c *FakeClock) WaitForTimers(n int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for len(c.timers) < n {
+		c.cond.Wait()
+	}
+}
+
+func (c *FakeClock) addTimer(d time.Duration, f func()) *fakeTimer {
+	timer := &fakeTimer{clock: c, f: f}
+	if f == nil {
+		timer.c = make(chan time.Time, 1)
+	}
+	c.lock.Lock()
+	timer.when = c.now.Add(d)
+	c.lock.Unlock()
+	if d <= 0 {
+		timer.fire(timer.when)
+		return timer
+	}
+	c.lock.Lock()
+	c.timers = append(c.timers, timer)
+	c.cond.Broadcast()
+	c.lock.Unlock()
+	return timer
+}
+
+func (c *FakeClock) removeTimer(timer *fakeTimer) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for i, t := range c.timers {
+		if t == timer {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type fakeTimer struct {
+	clock *FakeClock
+	when  time.Time
+	c     chan time.Time
+	f     func()
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	return t.clock.removeTimer(t)
+}
+
+func (t *fakeTimer) fire(now time.Time) {
+	if t.f != nil {
+		t.f()
+	} else {
+		t.c <- now
+	}
+}
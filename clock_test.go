@@ -0,0 +1,88 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/antongulenko/golib"
+	"github.com/stretchr/testify/suite"
+)
+
+type ClockTestSuite struct {
+	golib.AbstractTestSuite
+}
+
+func TestClock(t *testing.T) {
+	suite.Run(t, new(ClockTestSuite))
+}
+
+func (suite *ClockTestSuite) TestFakeTimers() {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	var fired []int
+	clock.AfterFunc(2*time.Second, func() { fired = append(fired, 2) })
+	clock.AfterFunc(time.Second, func() { fired = append(fired, 1) })
+	stopped := clock.AfterFunc(time.Second, func() { fired = append(fired, 0) })
+	timer := clock.NewTimer(3 * time.Second)
+	suite.True(stopped.Stop())
+	suite.Equal(3, clock.Timers())
+
+	clock.Advance(2 * time.Second)
+	suite.Equal([]int{1, 2}, fired)
+	suite.Len(timer.C(), 0)
+	clock.Advance(time.Second)
+	suite.Equal(time.Unix(1003, 0), <-timer.C())
+	suite.False(timer.Stop())
+	suite.Equal(0, clock.Timers())
+}
+
+func (suite *ClockTestSuite) TestWaitPrecise() {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	stopper := golib.NewStopChan()
+	lastTime := clock.Now()
+
+	done := make(chan bool)
+	go func() {
+		done <- waitPrecise(clock, stopper, 10*time.Second, &lastTime)
+	}()
+	// Wakes up every interval*timeoutLoopFactor
+	for i := 0; i < 9; i++ {
+		clock.WaitForTimers(1)
+		clock.Advance(time.Second)
+	}
+	clock.WaitForTimers(1)
+	clock.Advance(5 * time.Second)
+	suite.True(<-done)
+	suite.Equal(time.Unix(1014, 0), lastTime)
+
+	go func() {
+		done <- waitPrecise(clock, stopper, 10*time.Second, &lastTime)
+	}()
+	clock.WaitForTimers(1)
+	stopper.Stop()
+	suite.False(<-done)
+}
+
+func (suite *ClockTestSuite) TestWaitAligned() {
+	clock := NewFakeClock(time.Unix(1000, 300*int64(time.Millisecond)))
+	stopper := golib.NewStopChan()
+	var tickTime time.Time
+
+	done := make(chan bool)
+	go func() {
+		done <- waitAligned(clock, stopper, 500*time.Millisecond, &tickTime)
+	}()
+	clock.WaitForTimers(1)
+	clock.Advance(250 * time.Millisecond)
+	suite.True(<-done)
+	suite.Equal(time.Unix(1000, 500*int64(time.Millisecond)), tickTime)
+
+	// Missed ticks are skipped
+	clock.Advance(1200 * time.Millisecond)
+	go func() {
+		done <- waitAligned(clock, stopper, 500*time.Millisecond, &tickTime)
+	}()
+	clock.WaitForTimers(1)
+	clock.Advance(300 * time.Millisecond)
+	suite.True(<-done)
+	suite.Equal(time.Unix(1002, 0), tickTime)
+}
@@ -114,6 +114,8 @@ type Metric struct {
 	index  int
 	sample []bitflow.Value
 	reader MetricReader
+	entity *MetricEntity
+	node   *collectorNode // Not set for metrics describing the collectors themselves
 
 	// The use of this RWMutex is inverted: the Metric.Update() routine uses
 	// the read-lock, even though it writes data, because we every instance of Metric
@@ -146,9 +148,14 @@ func (s MetricSlice) Less(i, j int) bool {
 }
 
 func (s MetricSlice) ConstructSample(source *SampleSource) ([]string, func() []bitflow.Value) {
+	sort.Sort(s)
+	return s.constructSample(source)
+}
+
+// constructSample is like ConstructSample, but keeps the order of the metrics
+func (s MetricSlice) constructSample(source *SampleSource) ([]string, func() []bitflow.Value) {
 	var sampleLock sync.RWMutex // See comment at Metric.sampleLock
 
-	sort.Sort(s)
 	fields := make([]string, len(s))
 	values := make([]bitflow.Value, len(s))
 	for i, metric := range s {
@@ -169,6 +176,15 @@ func (s MetricSlice) ConstructSample(source *SampleSource) ([]string, func() []b
 	}
 }
 
+func (s MetricSlice) names() []string {
+	names := make([]string, len(s))
+	for i, metric := range s {
+		names[i] = metric.name
+	}
+	sort.Strings(names)
+	return names
+}
+
 func (s MetricSlice) UpdateAll() {
 	for _, metric := range s {
 		metric.Update()
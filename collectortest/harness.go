@@ -0,0 +1,204 @@
+// Package collectortest provides a harness for testing collectors: it initializes a tree of collectors,
+// performs synchronous update rounds driven by a FakeClock, and offers assertions on the resulting metrics.
+package collectortest
+
+import (
+	"reflect"
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/bitflow-stream/go-bitflow-collector"
+	"github.com/bitflow-stream/go-bitflow/bitflow"
+)
+
+// StartTime is the initial time of the FakeClock used by a Harness
+var StartTime = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Snapshot contains the values of all metrics after one update round
+type Snapshot map[string]bitflow.Value
+
+// Names returns the sorted metric names
+func (s Snapshot) Names() []string {
+	res := make([]string, 0, len(s))
+	for name := range s {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+type Harness struct {
+	T     testing.TB
+	Clock *collector.FakeClock
+
+	// Factory must be passed to the tested collectors. Its ValueRings use Clock.
+	Factory *collector.ValueRingFactory
+
+	// Interval is the time that passes on the Clock before every update round
+	Interval time.Duration
+
+	// Tree is set by Init()
+	Tree *collector.CollectorTree
+}
+
+func New(t testing.TB) *Harness {
+	clock := collector.NewFakeClock(StartTime)
+	return &Harness{
+		T:        t,
+		Clock:    clock,
+		Interval: time.Second,
+		Factory: &collector.ValueRingFactory{
+			Length:   100,
+			Interval: time.Second,
+			Clock:    clock,
+		},
+	}
+}
+
+// Init initializes the given root collectors and their sub-collectors, and fails the test on error.
+func (h *Harness) Init(roots ...collector.Collector) {
+	h.T.Helper()
+	if err := h.TryInit(roots...); err != nil {
+		h.T.Fatalf("Failed to initialize collectors %v: %v", roots, err)
+	}
+}
+
+// TryInit initializes the given root collectors and returns an error if all of them failed.
+func (h *Harness) TryInit(roots ...collector.Collector) error {
+	tree, err := collector.NewCollectorTree(h.Clock, roots...)
+	if err == nil {
+		h.Tree = tree
+	}
+	return err
+}
+
+// Round advances the Clock by Interval, performs one update round and returns the resulting metric values.
+// The update round is aborted when a collector reports MetricsChanged, see AssertMetricsChanged().
+func (h *Harness) Round() Snapshot {
+	h.T.Helper()
+	h.checkInitialized()
+	h.Clock.Advance(h.Interval)
+	h.Tree.Update()
+	return h.Snapshot()
+}
+
+// Run performs the given number of update rounds and returns the metric values after every round.
+func (h *Harness) Run(rounds int) []Snapshot {
+	h.T.Helper()
+	res := make([]Snapshot, rounds)
+	for i := range res {
+		res[i] = h.Round()
+	}
+	return res
+}
+
+// Snapshot returns the current values of all metrics
+func (h *Harness) Snapshot() Snapshot {
+	h.T.Helper()
+	h.checkInitialized()
+	return h.Tree.Metrics()
+}
+
+// AssertMetrics checks that all given metrics are collected
+func (h *Harness) AssertMetrics(names ...string) {
+	h.T.Helper()
+	snapshot := h.Snapshot()
+	for _, name := range names {
+		if _, ok := snapshot[name]; !ok {
+			h.T.Errorf("Metric %v is not collected. Collected metrics: %v", name, snapshot.Names())
+		}
+	}
+}
+
+// AssertNoMetrics checks that none of the given metrics are collected
+func (h *Harness) AssertNoMetrics(names ...string) {
+	h.T.Helper()
+	snapshot := h.Snapshot()
+	for _, name := range names {
+		if _, ok := snapshot[name]; ok {
+			h.T.Errorf("Metric %v should not be collected", name)
+		}
+	}
+}
+
+// AssertMetricsMatch checks that all collected metrics match the given regex, and that at least one metric is collected
+func (h *Harness) AssertMetricsMatch(regex string) {
+	h.T.Helper()
+	compiled := regexp.MustCompile(regex)
+	snapshot := h.Snapshot()
+	if len(snapshot) == 0 {
+		h.T.Errorf("No metrics are collected")
+	}
+	for _, name := range snapshot.Names() {
+		if !compiled.MatchString(name) {
+			h.T.Errorf("Metric %v does not match %v", name, regex)
+		}
+	}
+}
+
+// AssertValue checks the current value of the given metric
+func (h *Harness) AssertValue(name string, expected bitflow.Value) {
+	h.T.Helper()
+	if value, ok := h.Snapshot()[name]; !ok {
+		h.T.Errorf("Metric %v is not collected", name)
+	} else if value != expected {
+		h.T.Errorf("Unexpected value of metric %v: expected %v, got %v", name, expected, value)
+	}
+}
+
+// AssertMetadata checks that all collected metrics are described by their collectors, including their MetricKind
+func (h *Harness) AssertMetadata() {
+	h.T.Helper()
+	metadata := h.Tree.Metadata()
+	for _, name := range h.Snapshot().Names() {
+		if meta, ok := metadata[name]; !ok {
+			h.T.Errorf("Metric %v has no metadata", name)
+		} else if meta.Kind == collector.UnknownKind {
+			h.T.Errorf("Metric %v has no metric kind", name)
+		}
+	}
+}
+
+// AssertFailed checks that exactly the given collectors have failed
+func (h *Harness) AssertFailed(names ...string) {
+	h.T.Helper()
+	h.checkInitialized()
+	h.assertNames("failed collectors", names, h.Tree.Failed())
+}
+
+// AssertNotFailed checks that no collector has failed
+func (h *Harness) AssertNotFailed() {
+	h.T.Helper()
+	h.AssertFailed()
+}
+
+// AssertMetricsChanged checks that exactly the given collectors have reported MetricsChanged,
+// and initializes them again, so that the following rounds collect the changed metrics.
+func (h *Harness) AssertMetricsChanged(names ...string) {
+	h.T.Helper()
+	h.checkInitialized()
+	h.assertNames("collectors with changed metrics", names, h.Tree.Changed())
+	if err := h.Tree.Restart(); err != nil {
+		h.T.Fatalf("Failed to re-initialize collectors: %v", err)
+	}
+}
+
+func (h *Harness) assertNames(description string, expected []string, actual []string) {
+	h.T.Helper()
+	sort.Strings(expected)
+	if len(expected) == 0 && len(actual) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		h.T.Errorf("Unexpected %v: expected %v, got %v", description, expected, actual)
+	}
+}
+
+func (h *Harness) checkInitialized() {
+	h.T.Helper()
+	if h.Tree == nil {
+		h.T.Fatal("collectortest.Harness: Init() has not been called")
+	}
+}
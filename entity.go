@@ -0,0 +1,134 @@
+package collector
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bitflow-stream/go-bitflow/bitflow"
+)
+
+// MetricEntity describes an entity like a virtual machine or a group of processes, that a
+// set of metrics belongs to. When a SampleSource emits tagged samples (see SampleSource.TaggedSamples),
+// all metrics of one entity are delivered in a separate sample. The Prefix is removed from
+// the metric names and the Tags are attached to that sample. This way, all entities of
+// the same kind share the same set of fields.
+type MetricEntity struct {
+	// Prefix is shared by the names of all metrics of this entity, for example "libvirt/vm1/".
+	// Entities are identified by their prefix, so it must be unique.
+	Prefix string
+
+	// Tags are attached to samples of this entity, for example "vm=vm1".
+	Tags map[string]string
+}
+
+// EntityCollector can optionally be implemented by a Collector, if all its metrics belong
+// to a MetricEntity. Metrics that do not start with the prefix of the entity are treated like
+// metrics without entity.
+type EntityCollector interface {
+	Entity() *MetricEntity
+}
+
+// sampleGroup is a set of metrics that is emitted together as one sample.
+type sampleGroup struct {
+	metrics   MetricSlice
+	tags      map[string]string
+	header    *bitflow.Header
+	getValues func() []bitflow.Value
+
+	// Distinct nodes of the metrics, for determining the measurementTime()
+	nodes []*collectorNode
+}
+
+func (group *sampleGroup) makeSample(now time.Time) *bitflow.Sample {
+	group.metrics.UpdateAll()
+	return group.newSample(now)
+}
+
+// newSample copies the current metric values into a new sample, without reading the metrics again
+func (group *sampleGroup) newSample(now time.Time) *bitflow.Sample {
+	sample := &bitflow.Sample{
+		Time:   now,
+		Values: group.getValues(),
+	}
+	for key, value := range group.tags {
+		sample.SetTag(key, value)
+	}
+	return sample
+}
+
+func (source *SampleSource) createSampleGroups(metrics MetricSlice) []*sampleGroup {
+	if !source.TaggedSamples {
+		return []*sampleGroup{source.newSampleGroup(metrics, nil, nil)}
+	}
+
+	var plain MetricSlice
+	entities := make(map[string]MetricSlice)
+	entityTags := make(map[string]map[string]string)
+	for _, metric := range metrics {
+		entity := metric.entity
+		if entity == nil || !strings.HasPrefix(metric.name, entity.Prefix) {
+			plain = append(plain, metric)
+			continue
+		}
+		entities[entity.Prefix] = append(entities[entity.Prefix], &Metric{
+			name:   metric.name[len(entity.Prefix):],
+			reader: metric.reader,
+			entity: entity,
+			node:   metric.node,
+		})
+		entityTags[entity.Prefix] = entity.Tags
+	}
+
+	prefixes := make([]string, 0, len(entities))
+	for prefix := range entities {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	// Entities of the same kind deliver the same fields and should share the header instance
+	headers := make(map[string]*bitflow.Header)
+	groups := make([]*sampleGroup, 0, len(entities)+1)
+	if len(plain) > 0 {
+		groups = append(groups, source.newSampleGroup(plain, nil, headers))
+	}
+	for _, prefix := range prefixes {
+		groups = append(groups, source.newSampleGroup(entities[prefix], entityTags[prefix], headers))
+	}
+	return groups
+}
+
+func (source *SampleSource) newSampleGroup(metrics MetricSlice, tags map[string]string, headers map[string]*bitflow.Header) *sampleGroup {
+	var fields []string
+	var getValues func() []bitflow.Value
+	if len(source.PinnedHeader) > 0 {
+		// The metrics are already in the order of the pinned header
+		fields, getValues = metrics.constructSample(source)
+	} else {
+		fields, getValues = metrics.ConstructSample(source)
+	}
+	header := &bitflow.Header{Fields: fields}
+	if headers != nil {
+		key := strings.Join(fields, "\n")
+		if existing, ok := headers[key]; ok {
+			header = existing
+		} else {
+			headers[key] = header
+		}
+	}
+	var nodes []*collectorNode
+	distinctNodes := make(map[*collectorNode]bool)
+	for _, metric := range metrics {
+		if metric.node != nil && !distinctNodes[metric.node] {
+			distinctNodes[metric.node] = true
+			nodes = append(nodes, metric.node)
+		}
+	}
+	return &sampleGroup{
+		metrics:   metrics,
+		tags:      tags,
+		header:    header,
+		getValues: getValues,
+		nodes:     nodes,
+	}
+}
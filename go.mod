@@ -28,7 +28,7 @@ require (
 	k8s.io/apimachinery v0.17.4
 	k8s.io/klog v1.0.0 // indirect
 	sigs.k8s.io/controller-runtime v0.5.1
-	sigs.k8s.io/yaml v1.2.0 // indirect
+	sigs.k8s.io/yaml v1.2.0
 )
 
 // The replace-directives below are copied from github.com/bitflow-stream/bitflow-k8s-operator/bitflow-controller/go.mod
@@ -18,8 +18,20 @@ type collectorGraph struct {
 	failedList []*collectorNode
 	filtered   map[*collectorNode]bool
 
+	// The root collectors the graph has been initialized with
+	roots []Collector
+
+	// Nodes that must be initialized again, because their metrics have changed or they recovered from a failed Init()
+	changed []*collectorNode
+
 	collectors       map[Collector]*collectorNode
 	modificationLock sync.Mutex
+
+	// Dependencies and metric names of the nodes, set by prepareDescription()
+	descriptions map[*collectorNode]CollectorGraphNode
+
+	// Used for scheduling the updates of all nodes
+	clock Clock
 }
 
 func newEmptyGraph() *collectorGraph {
@@ -29,46 +41,174 @@ func newEmptyGraph() *collectorGraph {
 		failed:     make(map[*collectorNode]bool),
 		filtered:   make(map[*collectorNode]bool),
 		collectors: make(map[Collector]*collectorNode),
+		clock:      RealClock,
 	}
 }
 
 func initCollectorGraph(collectors []Collector) (*collectorGraph, error) {
 	g := newEmptyGraph()
+	g.roots = collectors
 	g.initNodes(collectors)
+	if err := g.validate(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (g *collectorGraph) validate() error {
 	if len(g.nodes) == 0 {
-		return nil, fmt.Errorf("All %v collectors have failed", len(g.failed))
+		return fmt.Errorf("All %v collectors have failed", len(g.failed))
 	}
 	if err := g.checkMissingDependencies(); err != nil {
-		return nil, err
+		return err
 	}
 	// Test if topological sort is possible (no cycles)
-	if _, err := topo.Sort(g); err != nil {
-		return nil, err
-	}
-	return g, nil
+	_, err := topo.Sort(g)
+	return err
 }
 
-func (g *collectorGraph) initNodes(collectors []Collector) {
+func (g *collectorGraph) initNodes(collectors []Collector) []*collectorNode {
+	nodes := make([]*collectorNode, 0, len(collectors))
 	for _, col := range collectors {
-		g.initNode(col)
+		if node := g.initNode(col); node != nil {
+			nodes = append(nodes, node)
+		}
 	}
+	return nodes
 }
 
-func (g *collectorGraph) initNode(col Collector) {
+func (g *collectorGraph) initNode(col Collector) *collectorNode {
 	if _, ok := g.collectors[col]; ok {
 		// This collector has already been added
-		return
+		return nil
 	}
 	node := g.newCollectorNode(col)
+	g.initCollectorNode(node)
+	return node
+}
+
+func (g *collectorGraph) initCollectorNode(node *collectorNode) {
 	children, err := node.init()
 	if err == nil {
-		g.initNodes(children)
+		node.children = g.initNodes(children)
 	} else {
 		g.collectorFailed(node)
 		log.Warnf("Collector %v failed: %v", node, err)
 	}
 }
 
+// reinitNodes initializes the given nodes again. Nodes created from sub-collectors that are returned again by Init()
+// are kept together with their own sub-collectors, so that the state of their collectors (e.g. ValueRings) is preserved.
+// The nodes of sub-collectors that are no longer returned are removed. All other nodes are not modified.
+func (g *collectorGraph) reinitNodes(nodes []*collectorNode) error {
+	for _, node := range nodes {
+		if g.collectors[node.collector] != node {
+			// The node has already been removed, because one of its parents was re-initialized
+			continue
+		}
+		log.Debugln("Re-initializing collector", node)
+		oldChildren := node.children
+		g.removeCollectorNode(node)
+		node.reset()
+		g.insertCollectorNode(node)
+		g.reinitCollectorNode(node, oldChildren)
+	}
+	return g.validate()
+}
+
+func (g *collectorGraph) reinitCollectorNode(node *collectorNode, oldChildren []*collectorNode) {
+	children, err := node.init()
+	keep := make(map[Collector]bool, len(children))
+	for _, child := range children {
+		keep[child] = true
+	}
+	kept := make(map[Collector]*collectorNode, len(oldChildren))
+	for _, child := range oldChildren {
+		if keep[child.collector] && err == nil {
+			kept[child.collector] = child
+		} else {
+			g.removeChildren(child)
+			g.removeCollectorNode(child)
+		}
+	}
+	if err != nil {
+		g.collectorFailed(node)
+		log.Warnf("Collector %v failed: %v", node, err)
+		return
+	}
+	for _, col := range children {
+		if child, ok := kept[col]; ok {
+			node.children = append(node.children, child)
+		} else if child := g.initNode(col); child != nil {
+			node.children = append(node.children, child)
+		}
+	}
+}
+
+// updateRoots removes the nodes of root collectors that are not contained in the given list, including all nodes
+// created from their sub-collectors, and initializes the root collectors that are not yet part of the graph.
+func (g *collectorGraph) updateRoots(roots []Collector) error {
+	newRoots := make(map[Collector]bool, len(roots))
+	for _, root := range roots {
+		newRoots[root] = true
+	}
+	for _, root := range g.roots {
+		if node, ok := g.collectors[root]; ok && !newRoots[root] {
+			log.Debugln("Removing root collector", node)
+			g.removeChildren(node)
+			g.removeCollectorNode(node)
+		}
+	}
+	for _, node := range g.initNodes(roots) {
+		log.Debugln("Initialized root collector", node)
+	}
+	g.roots = roots
+	return g.validate()
+}
+
+func (g *collectorGraph) removeChildren(node *collectorNode) {
+	for _, child := range node.children {
+		g.removeChildren(child)
+		g.removeCollectorNode(child)
+	}
+	node.children = nil
+}
+
+func (g *collectorGraph) removeCollectorNode(node *collectorNode) {
+	g.deleteCollector(node)
+	delete(g.collectors, node.collector)
+	for i, failed := range g.failedList {
+		if failed == node {
+			g.failedList = append(g.failedList[:i:i], g.failedList[i+1:]...)
+			break
+		}
+	}
+}
+
+// clone creates a copy of the graph that can be filtered and modified independently, but shares
+// the collectorNode instances. All nodes are assigned to the new graph, and their metric filters are reset.
+// Nodes that failed during their Update() routine are treated as failed in the new graph.
+func (g *collectorGraph) clone() *collectorGraph {
+	res := newEmptyGraph()
+	for col, node := range g.collectors {
+		res.collectors[col] = node
+		node.graph = res
+	}
+	for _, node := range g.failedList {
+		res.collectorFailed(node)
+	}
+	for node := range g.nodes {
+		node.resetMetrics()
+		if node.hasFailed {
+			res.collectorFailed(node)
+		} else {
+			res.nodes[node] = true
+			res.nodeIDs[node.uniqueID] = node
+		}
+	}
+	return res
+}
+
 func (g *collectorGraph) newCollectorNode(collector Collector) *collectorNode {
 	__nodeID++
 	node := &collectorNode{
@@ -117,10 +257,23 @@ func (g *collectorGraph) collectorUpdateFailed(node *collectorNode) {
 	// This means the collector Init() method was successful, but then Update() returned errors too many times.
 	g.modificationLock.Lock()
 	defer g.modificationLock.Unlock()
+	node.hasFailed = true
 	g.collectorFailed(node)
 	g.pruneAndRepair()
 }
 
+func (g *collectorGraph) collectorMetricsChanged(node *collectorNode) {
+	g.modificationLock.Lock()
+	defer g.modificationLock.Unlock()
+	g.changed = append(g.changed, node)
+}
+
+func (g *collectorGraph) changedNodes() []*collectorNode {
+	g.modificationLock.Lock()
+	defer g.modificationLock.Unlock()
+	return g.changed
+}
+
 func (g *collectorGraph) checkMissingDependencies() error {
 	for node := range g.nodes {
 		for _, depends := range node.collector.Depends() {
@@ -139,19 +292,20 @@ func (g *collectorGraph) applyMetricFilters(exclude []*regexp.Regexp, include []
 	}
 }
 
-func (g *collectorGraph) applyCollectorFilters(deleteNames []string) {
+func (g *collectorGraph) applyCollectorFilters(isDisabled func(name string) bool) {
 	for node := range g.nodes {
-		for _, deleteName := range deleteNames {
-			if deleteName == node.String() {
-				log.Debugln("Disabling collector", deleteName)
-				g.deleteCollector(node)
-				break
-			}
+		if name := node.String(); isDisabled(name) {
+			log.Debugln("Disabling collector", name)
+			g.deleteCollector(node)
 		}
 	}
 }
 
 func (g *collectorGraph) applyUpdateFrequencies(frequencies map[*regexp.Regexp]time.Duration) {
+	// The nodes are reused when the collection is restarted, so frequencies that have been removed must be reset
+	for node := range g.nodes {
+		node.UpdateFrequency = 0
+	}
 	for regex, freq := range frequencies {
 		count := 0
 		for node := range g.nodes {
@@ -164,6 +318,23 @@ func (g *collectorGraph) applyUpdateFrequencies(frequencies map[*regexp.Regexp]t
 	}
 }
 
+func (g *collectorGraph) applyUpdateTimeouts(defaultTimeout time.Duration, timeouts map[*regexp.Regexp]time.Duration) {
+	// Apply to all collectors, including failed ones, since their Update() is also called when checking for recovery
+	for _, node := range g.collectors {
+		node.UpdateTimeout = defaultTimeout
+	}
+	for regex, timeout := range timeouts {
+		count := 0
+		for _, node := range g.collectors {
+			if regex.MatchString(node.String()) {
+				node.UpdateTimeout = timeout
+				count++
+			}
+		}
+		log.Debugf("Update timeout %v applied to %v nodes matching %v", timeout, count, regex.String())
+	}
+}
+
 func (g *collectorGraph) dependsOnFailedOrFiltered(node *collectorNode) bool {
 	for _, dependencyCol := range node.collector.Depends() {
 		dependency := g.resolve(dependencyCol)
@@ -255,12 +426,34 @@ func (g *collectorGraph) fillMetricNames(all map[string]bool) {
 	}
 }
 
-func (g *collectorGraph) getMetrics() (res MetricSlice) {
-	for node := range g.nodes {
+func (g *collectorGraph) getMetadata() MetricMetadataMap {
+	return getMetadata(g.nodes)
+}
+
+func getMetadata(nodes map[*collectorNode]bool) MetricMetadataMap {
+	res := make(MetricMetadataMap)
+	for node := range nodes {
+		for metric := range node.metrics {
+			if meta, ok := node.metadata[metric]; ok {
+				res[metric] = meta
+			}
+		}
+	}
+	return res
+}
+
+func (g *collectorGraph) getMetrics() MetricSlice {
+	return getMetrics(g.nodes)
+}
+
+func getMetrics(nodes map[*collectorNode]bool) (res MetricSlice) {
+	for node := range nodes {
 		for name, reader := range node.metrics {
 			res = append(res, &Metric{
 				name:   name,
 				reader: reader,
+				entity: node.entity,
+				node:   node,
 			})
 		}
 	}
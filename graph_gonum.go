@@ -13,8 +13,16 @@ import (
 	"gonum.org/v1/gonum/graph/simple"
 )
 
+// MarshalDOT returns the DOT-representation of the active collectors in the graph.
+func (g *collectorGraph) MarshalDOT() ([]byte, error) {
+	// Failed collectors are removed from the graph concurrently
+	g.modificationLock.Lock()
+	defer g.modificationLock.Unlock()
+	return dot.Marshal(g, "Collectors", "", "")
+}
+
 func (g *collectorGraph) WriteGraphPNG(filename string) error {
-	dotData, err := dot.Marshal(g, "Collectors", "", "")
+	dotData, err := g.MarshalDOT()
 	if err != nil {
 		return err
 	}
@@ -43,7 +51,7 @@ func (g *collectorGraph) WriteGraphPNG(filename string) error {
 }
 
 func (g *collectorGraph) WriteGraphDOT(filename string) error {
-	dotData, err := dot.Marshal(g, "Collectors", "", "")
+	dotData, err := g.MarshalDOT()
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,77 @@
+package collector
+
+import (
+	"errors"
+	"sort"
+)
+
+// CollectorGraphNode describes one collector in the graph of the current collection round, see SampleSource.CollectorGraph().
+type CollectorGraphNode struct {
+	CollectorStatistics
+	Depends []string `json:"depends,omitempty"`
+	Metrics []string `json:"metrics,omitempty"`
+}
+
+// errNotCollecting is returned when the graph is requested before the metric collection has been started.
+var errNotCollecting = errors.New("The metric collection has not been started")
+
+// CollectorGraph returns the active, failed and filtered collectors of the current collection round, including their
+// dependencies and their metrics after applying the metric filters, sorted by name.
+func (source *SampleSource) CollectorGraph() ([]CollectorGraphNode, error) {
+	graph := source.getCurrentGraph()
+	if graph == nil {
+		return nil, errNotCollecting
+	}
+	return graph.describe(), nil
+}
+
+// CollectorGraphDOT returns the DOT-representation of the active collectors of the current collection round.
+func (source *SampleSource) CollectorGraphDOT() ([]byte, error) {
+	graph := source.getCurrentGraph()
+	if graph == nil {
+		return nil, errNotCollecting
+	}
+	return graph.MarshalDOT()
+}
+
+func (source *SampleSource) getCurrentGraph() *collectorGraph {
+	source.currentGraphLock.Lock()
+	defer source.currentGraphLock.Unlock()
+	return source.currentGraph
+}
+
+// prepareDescription stores the dependencies and metric names of all nodes for describe(). It must be called before the graph
+// is published in SampleSource.currentGraph: the nodes are shared with the graph of the next collection round,
+// which replaces and filters their metrics while the REST API might still describe this graph.
+func (g *collectorGraph) prepareDescription() {
+	g.descriptions = make(map[*collectorNode]CollectorGraphNode, len(g.collectors))
+	for _, node := range g.collectors {
+		var desc CollectorGraphNode
+		for _, depends := range node.collector.Depends() {
+			desc.Depends = append(desc.Depends, g.resolve(depends).String())
+		}
+		for name := range node.metrics {
+			desc.Metrics = append(desc.Metrics, name)
+		}
+		sort.Strings(desc.Depends)
+		sort.Strings(desc.Metrics)
+		g.descriptions[node] = desc
+	}
+}
+
+func (g *collectorGraph) describe() []CollectorGraphNode {
+	res := make([]CollectorGraphNode, 0, len(g.collectors))
+	for _, node := range g.collectors {
+		state, ok := g.nodeState(node)
+		if !ok {
+			continue
+		}
+		desc := g.descriptions[node]
+		desc.CollectorStatistics = node.statistics(state)
+		res = append(res, desc)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
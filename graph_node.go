@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"fmt"
 	"regexp"
 	"sync"
 	"time"
@@ -20,15 +21,41 @@ type collectorNode struct {
 	graph     *collectorGraph
 	uniqueID  int64
 
-	failedUpdates int
-	hasFailed     bool
+	hasFailed bool
 
-	metrics MetricReaderMap
+	// Update statistics, see statistics.go. The failedUpdates counter is also protected by statsLock.
+	statsLock          sync.Mutex
+	failedUpdates      int
+	updates            uint64
+	totalFailures      uint64
+	lastUpdate         time.Time
+	lastUpdateDuration time.Duration
+	lastUpdateFailed   bool
+	lastMeasurement    time.Time // End of the last successful update
+
+	// Failure handling, also protected by statsLock. The retry state is kept across collection rounds.
+	retryPolicy RetryPolicy
+	retry       RetryState
+
+	// Nodes created from the sub-collectors returned by Init()
+	children []*collectorNode
+
+	// All metrics of the collector, and the subset of metrics that passed the metric filters
+	availableMetrics MetricReaderMap
+	metrics          MetricReaderMap
+	metadata         MetricMetadataMap
+	rings            MetricRingMap
+	entity           *MetricEntity
 
 	preconditions  []*golib.BoolCondition
 	postconditions []*golib.BoolCondition
 
 	UpdateFrequency time.Duration
+	UpdateTimeout   time.Duration
+
+	// Result of an Update() call that did not return within UpdateTimeout, protected by updateLock
+	pendingUpdate chan error
+	updateLock    sync.Mutex
 }
 
 func (node *collectorNode) String() string {
@@ -40,16 +67,55 @@ func (node *collectorNode) init() ([]Collector, error) {
 	if err != nil {
 		return nil, err
 	}
-	node.metrics = node.collector.Metrics()
-	if node.metrics == nil {
+	node.availableMetrics = node.collector.Metrics()
+	if node.availableMetrics == nil {
 		// Implement isInitialized: make sure a successful init() leaves a non-nil metrics map.
-		node.metrics = make(MetricReaderMap)
+		node.availableMetrics = make(MetricReaderMap)
+	}
+	node.resetMetrics()
+	if described, ok := node.collector.(DescribedCollector); ok {
+		node.metadata = described.MetricsMetadata()
+	}
+	if windowed, ok := node.collector.(WindowedCollector); ok {
+		node.rings = windowed.MetricRings()
+	}
+	if entityCol, ok := node.collector.(EntityCollector); ok {
+		node.entity = entityCol.Entity()
 	}
 	return children, nil
 }
 
 func (node *collectorNode) isInitialized() bool {
-	return node.metrics != nil
+	return node.availableMetrics != nil
+}
+
+// resetMetrics restores the metrics that have been removed by applyMetricFilters()
+func (node *collectorNode) resetMetrics() {
+	node.metrics = make(MetricReaderMap, len(node.availableMetrics))
+	for name, reader := range node.availableMetrics {
+		node.metrics[name] = reader
+	}
+}
+
+// reset prepares the node for calling init() again
+func (node *collectorNode) reset() {
+	node.availableMetrics = nil
+	node.metrics = nil
+	node.metadata = nil
+	node.rings = nil
+	node.entity = nil
+	node.children = nil
+	node.resetFailedUpdates()
+	node.statsLock.Lock()
+	node.lastUpdateFailed = false
+	node.lastMeasurement = time.Time{}
+	node.statsLock.Unlock()
+	node.hasFailed = false
+}
+
+func (node *collectorNode) resetConditions() {
+	node.preconditions = nil
+	node.postconditions = nil
 }
 
 func (node *collectorNode) applyMetricFilters(exclude []*regexp.Regexp, include []*regexp.Regexp) {
@@ -120,10 +186,15 @@ func (node *collectorNode) updateAndBroadcast(stopper golib.StopChan, lastUpdate
 		// Node has been deleted due to failed dependency
 		return false
 	}
+	return node.updateIfDue(stopper, lastUpdate)
+}
 
+// updateIfDue calls update(), unless UpdateFrequency is set and has not passed since *lastUpdate.
+// It returns false if the node should not be updated anymore in the current collection round.
+func (node *collectorNode) updateIfDue(stopper golib.StopChan, lastUpdate *time.Time) bool {
 	successfulUpdate := true
 	if node.UpdateFrequency > 0 {
-		now := time.Now()
+		now := node.graph.clock.Now()
 		if now.Sub(*lastUpdate) >= node.UpdateFrequency {
 			successfulUpdate = node.update(stopper)
 			*lastUpdate = now
@@ -135,27 +206,79 @@ func (node *collectorNode) updateAndBroadcast(stopper golib.StopChan, lastUpdate
 }
 
 func (node *collectorNode) update(stopper golib.StopChan) bool {
-	err := node.collector.Update()
+	start := node.graph.clock.Now()
+	err := node.callUpdate()
+	node.recordUpdate(start, node.graph.clock.Now().Sub(start), err != nil && err != MetricsChanged)
 	if err == MetricsChanged {
 		log.Warnln("Metrics of", node, "have changed! Restarting metric collection.")
+		node.graph.collectorMetricsChanged(node)
 		stopper.Stop()
 		return false
 	} else if err != nil {
 		log.Warnln("Update of", node, "failed:", err)
 		return !node.updateFailed()
 	} else {
-		node.failedUpdates = 0
+		node.resetFailedUpdates()
 		return true
 	}
 }
 
+// callUpdate invokes the Update() method of the collector. If UpdateTimeout is set and Update() does not return in time,
+// an error is returned. In that case, no further Update() is started until the hanging call returns.
+func (node *collectorNode) callUpdate() error {
+	timeout := node.UpdateTimeout
+	if timeout <= 0 {
+		return node.collector.Update()
+	}
+	node.updateLock.Lock()
+	defer node.updateLock.Unlock()
+	if node.pendingUpdate == nil {
+		result := make(chan error, 1)
+		node.pendingUpdate = result
+		go func() {
+			result <- node.collector.Update()
+		}()
+	}
+	timer := node.graph.clock.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-node.pendingUpdate:
+		node.pendingUpdate = nil
+		return err
+	case <-timer.C():
+		return fmt.Errorf("Update() did not return within %v", timeout)
+	}
+}
+
+// hasPendingUpdate returns true if an Update() call has exceeded its timeout, and its result has not been received yet.
+func (node *collectorNode) hasPendingUpdate() bool {
+	node.updateLock.Lock()
+	defer node.updateLock.Unlock()
+	return node.pendingUpdate != nil
+}
+
 func (node *collectorNode) updateFailed() bool {
+	node.statsLock.Lock()
+	tolerated := node.retryPolicy.ToleratedFailures
+	if tolerated <= 0 {
+		tolerated = ToleratedUpdateFailures
+	}
 	node.failedUpdates++
-	if node.failedUpdates >= ToleratedUpdateFailures {
-		log.Warnln("Collector", node, "exceeded tolerated number of", ToleratedUpdateFailures, "consecutive failures")
+	exceeded := node.failedUpdates >= tolerated
+	if exceeded {
 		node.failedUpdates = 0
+	}
+	node.statsLock.Unlock()
+	if exceeded {
+		log.Warnln("Collector", node, "exceeded tolerated number of", tolerated, "consecutive failures")
 		node.graph.collectorUpdateFailed(node)
 		return true
 	}
 	return false
 }
+
+func (node *collectorNode) resetFailedUpdates() {
+	node.statsLock.Lock()
+	defer node.statsLock.Unlock()
+	node.failedUpdates = 0
+}
@@ -0,0 +1,245 @@
+package collector
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/antongulenko/golib"
+	"github.com/bitflow-stream/go-bitflow/bitflow"
+	"github.com/stretchr/testify/suite"
+)
+
+type testCollector struct {
+	AbstractCollector
+	lock    sync.Mutex
+	updates int
+	err     error
+	block   chan struct{}
+}
+
+func newTestCollector(name string) *testCollector {
+	return &testCollector{AbstractCollector: RootCollector(name)}
+}
+
+func (col *testCollector) Metrics() MetricReaderMap {
+	return MetricReaderMap{col.Name: func() bitflow.Value { return 1 }}
+}
+
+func (col *testCollector) Update() error {
+	col.lock.Lock()
+	block := col.block
+	col.lock.Unlock()
+	if block != nil {
+		<-block
+	}
+	col.lock.Lock()
+	defer col.lock.Unlock()
+	col.updates++
+	return col.err
+}
+
+func (col *testCollector) setError(err error) {
+	col.lock.Lock()
+	defer col.lock.Unlock()
+	col.err = err
+}
+
+func (col *testCollector) numUpdates() int {
+	col.lock.Lock()
+	defer col.lock.Unlock()
+	return col.updates
+}
+
+type GraphNodeTestSuite struct {
+	golib.AbstractTestSuite
+	clock *FakeClock
+}
+
+func TestGraphNode(t *testing.T) {
+	suite.Run(t, new(GraphNodeTestSuite))
+}
+
+func (suite *GraphNodeTestSuite) SetupTest() {
+	suite.clock = NewFakeClock(time.Unix(1000, 0))
+}
+
+func (suite *GraphNodeTestSuite) newGraph(cols ...Collector) *collectorGraph {
+	graph, err := initCollectorGraph(cols)
+	suite.NoError(err)
+	graph = graph.clone()
+	graph.clock = suite.clock
+	return graph
+}
+
+func (suite *GraphNodeTestSuite) TestUpdateFrequency() {
+	col := newTestCollector("col")
+	graph := suite.newGraph(col)
+	node := graph.collectors[col]
+	graph.applyUpdateFrequencies(map[*regexp.Regexp]time.Duration{regexp.MustCompile("^col$"): 3 * time.Second})
+	suite.Equal(3*time.Second, node.UpdateFrequency)
+
+	stopper := golib.NewStopChan()
+	var lastUpdate time.Time
+	for i := 0; i < 10; i++ {
+		suite.True(node.updateAndBroadcast(stopper, &lastUpdate))
+		suite.clock.Advance(time.Second)
+	}
+	// Updates at 0s, 3s, 6s and 9s
+	suite.Equal(4, col.numUpdates())
+	suite.Equal(uint64(4), node.statistics(CollectorActive).Updates)
+
+	// Removed frequencies are reset
+	graph.applyUpdateFrequencies(nil)
+	suite.Equal(time.Duration(0), node.UpdateFrequency)
+}
+
+func (suite *GraphNodeTestSuite) TestUpdateEveryRound() {
+	col := newTestCollector("col")
+	graph := suite.newGraph(col)
+	node := graph.collectors[col]
+
+	stopper := golib.NewStopChan()
+	var lastUpdate time.Time
+	for i := 0; i < 5; i++ {
+		suite.True(node.updateAndBroadcast(stopper, &lastUpdate))
+	}
+	suite.Equal(5, col.numUpdates())
+
+	stopper.Stop()
+	suite.False(node.updateAndBroadcast(stopper, &lastUpdate))
+	suite.Equal(5, col.numUpdates())
+}
+
+func (suite *GraphNodeTestSuite) TestToleratedFailures() {
+	col := newTestCollector("col")
+	other := newTestCollector("other")
+	graph := suite.newGraph(col, other)
+	graph.applyRetryPolicies(RetryPolicy{ToleratedFailures: 3}, nil, time.Second)
+	node := graph.collectors[col]
+	stopper := golib.NewStopChan()
+
+	col.setError(errors.New("update failed"))
+	suite.True(node.update(stopper))
+	suite.True(node.update(stopper))
+	suite.Equal(2, node.statistics(CollectorActive).ConsecutiveFailures)
+
+	// A successful update resets the counter of consecutive failures
+	col.setError(nil)
+	suite.True(node.update(stopper))
+	suite.Equal(0, node.statistics(CollectorActive).ConsecutiveFailures)
+
+	col.setError(errors.New("update failed"))
+	suite.True(node.update(stopper))
+	suite.True(node.update(stopper))
+	suite.False(node.update(stopper))
+	state, ok := graph.nodeState(node)
+	suite.True(ok)
+	suite.Equal(CollectorFailed, state)
+	suite.Equal(uint64(5), node.statistics(state).Failures)
+	suite.True(graph.nodes[graph.collectors[other]])
+}
+
+func (suite *GraphNodeTestSuite) TestRetryBackoff() {
+	col := newTestCollector("col")
+	graph := suite.newGraph(col)
+	graph.applyRetryPolicies(RetryPolicy{BackoffBase: 10 * time.Second, BackoffMax: 30 * time.Second}, nil, time.Second)
+	node := graph.collectors[col]
+
+	now := suite.clock.Now()
+	suite.False(node.retryDue(now), "first check only schedules the retry")
+	suite.False(node.retryDue(now.Add(9 * time.Second)))
+	suite.True(node.retryDue(now.Add(10 * time.Second)))
+
+	now = now.Add(10 * time.Second)
+	node.retryFailed(now)
+	suite.False(node.retryDue(now.Add(19 * time.Second)))
+	suite.True(node.retryDue(now.Add(20 * time.Second)))
+
+	now = now.Add(20 * time.Second)
+	node.retryFailed(now)
+	suite.False(node.retryDue(now.Add(29*time.Second)), "delay is limited by BackoffMax")
+	suite.True(node.retryDue(now.Add(30 * time.Second)))
+
+	node.resetRetry()
+	suite.Equal(&RetryState{}, node.statistics(CollectorFailed).Retry)
+}
+
+func (suite *GraphNodeTestSuite) TestUpdateTimeout() {
+	col := newTestCollector("col")
+	col.block = make(chan struct{})
+	graph := suite.newGraph(col)
+	graph.applyUpdateTimeouts(5*time.Second, nil)
+	node := graph.collectors[col]
+
+	result := make(chan error, 1)
+	go func() {
+		result <- node.callUpdate()
+	}()
+	suite.clock.WaitForTimers(1)
+	suite.clock.Advance(5 * time.Second)
+	suite.Error(<-result)
+
+	// The hanging Update() is not started again, but its result is returned once it finishes
+	go func() {
+		result <- node.callUpdate()
+	}()
+	suite.clock.WaitForTimers(1)
+	close(col.block)
+	suite.NoError(<-result)
+	suite.Equal(1, col.numUpdates())
+}
+
+func (suite *GraphNodeTestSuite) TestDescribe() {
+	parent := newTestCollector("parent")
+	child := &dependentCollector{testCollector: testCollector{AbstractCollector: RootCollector("child")}, depends: []Collector{parent}}
+	failed := newTestCollector("failed")
+	graph := suite.newGraph(parent, child, failed)
+	graph.applyMetricFilters(nil, []*regexp.Regexp{regexp.MustCompile("^(child|failed)$")})
+	graph.collectorUpdateFailed(graph.collectors[failed])
+	graph.prepareDescription()
+
+	// The next collection round resets the metric filters of the shared nodes
+	graph.clone()
+
+	nodes := graph.describe()
+	suite.Len(nodes, 3)
+	suite.Equal("child", nodes[0].Name)
+	suite.Equal(CollectorActive, nodes[0].State)
+	suite.Equal([]string{"parent"}, nodes[0].Depends)
+	suite.Equal([]string{"child"}, nodes[0].Metrics)
+	suite.Equal("failed", nodes[1].Name)
+	suite.Equal(CollectorFailed, nodes[1].State)
+	suite.NotNil(nodes[1].Retry)
+	suite.Equal("parent", nodes[2].Name)
+	suite.Empty(nodes[2].Depends)
+	suite.Empty(nodes[2].Metrics)
+}
+
+func (suite *GraphNodeTestSuite) TestDisabledCollectors() {
+	parent := newTestCollector("parent")
+	child := &dependentCollector{testCollector: testCollector{AbstractCollector: RootCollector("parent/child")}, depends: []Collector{parent}}
+	other := newTestCollector("other")
+	source := &SampleSource{RootCollectors: []Collector{parent, child, other}}
+
+	names := func() []string {
+		graph, err := source.createFilteredGraph()
+		suite.NoError(err)
+		res := graph.listMetricNames()
+		sort.Strings(res)
+		return res
+	}
+	suite.Equal([]string{"other", "parent", "parent/child"}, names())
+
+	// Collectors depending on a disabled collector are removed as well
+	source.DisabledCollectorRegexes = []*regexp.Regexp{regexp.MustCompile("^par")}
+	suite.Equal([]string{"other"}, names())
+	source.DisabledCollectorRegexes = []*regexp.Regexp{regexp.MustCompile("/child$")}
+	suite.Equal([]string{"other", "parent"}, names())
+	source.DisabledCollectorRegexes = nil
+	source.DisabledCollectors = []string{"other"}
+	suite.Equal([]string{"parent", "parent/child"}, names())
+}
@@ -25,6 +25,19 @@ const LocalUri = "qemu:///system"
 	v.GetAutostart()
 */
 
+func init() {
+	collector.RegisterCollector(&collector.CollectorFactory{
+		Name:        "libvirt",
+		Description: "Metrics of virtual machines managed by libvirt",
+		Parameters: []collector.FactoryParameter{
+			{Name: "uri", Type: collector.StringParameter, Default: LocalUri, Description: "Libvirt connection uri"},
+		},
+		New: func(params collector.CollectorParameters, factory *collector.ValueRingFactory) ([]collector.Collector, error) {
+			return []collector.Collector{NewLibvirtCollector(params.String("uri"), NewDriver(), factory)}, nil
+		},
+	})
+}
+
 func SshUri(host string, keyFile string) string {
 	if keyFile != "" {
 		keyFile = "&keyfile=" + keyFile
@@ -38,6 +51,9 @@ type Collector struct {
 	driver     Driver
 	factory    *collector.ValueRingFactory
 	domains    map[string]Domain
+
+	// The collectors of the VMs are reused when the domains change, so that their ValueRings are not reset
+	vms map[string]*vmCollector
 }
 
 func NewLibvirtCollector(uri string, driver Driver, factory *collector.ValueRingFactory) *Collector {
@@ -56,9 +72,18 @@ func (parent *Collector) Init() ([]collector.Collector, error) {
 		return nil, err
 	}
 	res := make([]collector.Collector, 0, len(parent.domains))
+	vms := make(map[string]*vmCollector, len(parent.domains))
 	for name, domain := range parent.domains {
-		res = append(res, parent.newVmCollector(name, domain))
+		vm, ok := parent.vms[name]
+		if ok {
+			vm.domain = domain
+		} else {
+			vm = parent.newVmCollector(name, domain)
+		}
+		vms[name] = vm
+		res = append(res, vm)
 	}
+	parent.vms = vms
 	return res, nil
 }
 
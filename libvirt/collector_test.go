@@ -0,0 +1,201 @@
+// +build nolibvirt
+
+package libvirt
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/antongulenko/golib"
+	"github.com/bitflow-stream/go-bitflow-collector"
+	"github.com/bitflow-stream/go-bitflow-collector/collectortest"
+	"github.com/bitflow-stream/go-bitflow/bitflow"
+	"github.com/stretchr/testify/suite"
+)
+
+const testDomainXML = `<domain>
+	<devices>
+		<disk device="disk"><target dev="vda"/></disk>
+		<interface><target dev="vnet0"/></interface>
+	</devices>
+</domain>`
+
+type LibvirtTestSuite struct {
+	golib.AbstractTestSuite
+	driver  *MockDriver
+	harness *collectortest.Harness
+}
+
+func TestLibvirtCollector(t *testing.T) {
+	suite.Run(t, new(LibvirtTestSuite))
+}
+
+func (s *LibvirtTestSuite) SetupTest() {
+	s.driver = new(MockDriver)
+	s.harness = collectortest.New(s.T())
+}
+
+func (s *LibvirtTestSuite) newDomain(name string) *MockDomain {
+	domain := &MockDomain{
+		Name:       name,
+		XML:        testDomainXML,
+		Info:       DomainInfo{MaxMem: 2048, Mem: 1024},
+		Memory:     VirDomainMemoryStat{Available: 1000, Unused: 250},
+		Blocks:     map[string]VirDomainBlockStats{"vda": {}},
+		BlockInfos: map[string]VirDomainBlockInfo{"vda": {Allocation: 10, Capacity: 100}},
+		Interfaces: map[string]VirDomainInterfaceStats{"vnet0": {}},
+	}
+	s.driver.Domains = append(s.driver.Domains, domain)
+	return domain
+}
+
+func (s *LibvirtTestSuite) init() {
+	s.harness.Init(NewLibvirtCollector(LocalUri, s.driver, s.harness.Factory))
+}
+
+// advance simulates a VM using half a CPU core and sending 1000 bytes per second
+func (s *LibvirtTestSuite) advance(domain *MockDomain) {
+	cpuTime := uint64(s.harness.Interval.Nanoseconds()) / 2
+	domain.Info.CpuTime += cpuTime
+	domain.Cpu.CpuTime += cpuTime
+	domain.Cpu.UserTime += cpuTime
+	iface := domain.Interfaces["vnet0"]
+	iface.TxBytes += 1000 * int64(s.harness.Interval/time.Second)
+	domain.Interfaces["vnet0"] = iface
+}
+
+func (s *LibvirtTestSuite) TestConnectionError() {
+	s.driver.InjectedErr = errors.New("connection refused")
+	s.Error(s.harness.TryInit(NewLibvirtCollector(LocalUri, s.driver, s.harness.Factory)))
+}
+
+func (s *LibvirtTestSuite) TestNoDomains() {
+	s.init()
+	s.harness.Run(2)
+	s.harness.AssertNotFailed()
+	s.harness.AssertMetricsChanged()
+	s.Empty(s.harness.Snapshot())
+}
+
+func (s *LibvirtTestSuite) TestDomainMetrics() {
+	domain := s.newDomain("vm1")
+	s.init()
+	for i := 0; i < 5; i++ {
+		s.advance(domain)
+		s.harness.Round()
+	}
+	s.harness.AssertNotFailed()
+	s.harness.AssertMetrics(
+		"libvirt/vm1/general/cpu", "libvirt/vm1/general/mem", "libvirt/vm1/general/maxMem",
+		"libvirt/vm1/cpu", "libvirt/vm1/cpu/user",
+		"libvirt/vm1/mem/available", "libvirt/vm1/mem/used", "libvirt/vm1/mem/percent",
+		"libvirt/vm1/block/io", "libvirt/vm1/block/allocation", "libvirt/vm1/block/capacity",
+		"libvirt/vm1/net-io/bytes", "libvirt/vm1/net-io/tx_bytes")
+	s.harness.AssertMetadata()
+	s.harness.AssertValue("libvirt/vm1/general/cpu", 50)
+	s.harness.AssertValue("libvirt/vm1/cpu", 50)
+	s.harness.AssertValue("libvirt/vm1/cpu/user", 50)
+	s.harness.AssertValue("libvirt/vm1/cpu/system", 0)
+	s.harness.AssertValue("libvirt/vm1/general/mem", 1024)
+	s.harness.AssertValue("libvirt/vm1/mem/used", 750)
+	s.harness.AssertValue("libvirt/vm1/mem/percent", 75)
+}
+
+func (s *LibvirtTestSuite) TestNewDomain() {
+	s.newDomain("vm1")
+	s.init()
+	s.harness.Run(2)
+	s.harness.AssertNoMetrics("libvirt/vm2/cpu")
+
+	s.newDomain("vm2")
+	s.harness.Round()
+	s.harness.AssertMetricsChanged("libvirt")
+	s.harness.Round()
+	s.harness.AssertNotFailed()
+	s.harness.AssertMetrics("libvirt/vm1/cpu", "libvirt/vm2/cpu")
+}
+
+func (s *LibvirtTestSuite) TestNewDomainKeepsRings() {
+	domain := s.newDomain("vm1")
+	s.init()
+	for i := 0; i < 3; i++ {
+		s.advance(domain)
+		s.harness.Round()
+	}
+	s.harness.AssertValue("libvirt/vm1/cpu", 50)
+
+	s.newDomain("vm2")
+	s.advance(domain)
+	s.harness.Round()
+	s.harness.AssertMetricsChanged("libvirt")
+
+	// The collectors of vm1 are reused, so the rates are computed from the values before the restart
+	s.advance(domain)
+	s.harness.Round()
+	s.harness.AssertNotFailed()
+	s.harness.AssertMetrics("libvirt/vm1/cpu", "libvirt/vm2/cpu")
+	s.harness.AssertValue("libvirt/vm1/cpu", 50)
+}
+
+func (s *LibvirtTestSuite) TestDomainReboot() {
+	domain := s.newDomain("vm1")
+	s.init()
+	for i := 0; i < 3; i++ {
+		s.advance(domain)
+		s.harness.Round()
+	}
+	s.harness.AssertValue("libvirt/vm1/cpu", 50)
+
+	// The CPU time is reset when the VM reboots
+	domain.Cpu = VirDomainCpuStats{}
+	s.harness.Round()
+	s.harness.AssertValue("libvirt/vm1/cpu", 0)
+	for i := 0; i < 3; i++ {
+		s.advance(domain)
+		s.harness.Round()
+	}
+	s.harness.AssertValue("libvirt/vm1/cpu", 50)
+	for _, stats := range s.harness.Tree.Statistics() {
+		if stats.Name == "libvirt/vm1/cpu" {
+			// The total and user CPU time have been reset, system and virtual CPU time remained zero
+			s.Equal(uint64(2), stats.CounterResets)
+		}
+	}
+}
+
+func (s *LibvirtTestSuite) TestInterfaceError() {
+	domain := s.newDomain("vm1")
+	s.NoError(s.driver.Connect(LocalUri))
+	_, err := s.driver.ListDomains()
+	s.NoError(err)
+	vm := NewLibvirtCollector(LocalUri, s.driver, s.harness.Factory).newVmCollector("vm1", domain)
+	col := NewInterfaceStatCollector(vm)
+	col.interfaces = []string{"vnet0", "vnet1"}
+	domain.Interfaces["vnet1"] = VirDomainInterfaceStats{}
+	for i := 0; i < 2; i++ {
+		s.advance(domain)
+		s.harness.Clock.Advance(s.harness.Interval)
+		s.NoError(col.Update())
+	}
+
+	// The stats of vnet0 must not be added to the next value when vnet1 fails
+	delete(domain.Interfaces, "vnet1")
+	s.Error(col.Update())
+	domain.Interfaces["vnet1"] = VirDomainInterfaceStats{}
+	s.advance(domain)
+	s.harness.Clock.Advance(s.harness.Interval)
+	s.NoError(col.Update())
+	s.Equal(collector.Counter64(3000), col.net.TxBytes.GetHead())
+	s.Equal(bitflow.Value(1000), col.net.TxBytes.GetDiff())
+}
+
+func (s *LibvirtTestSuite) TestDomainError() {
+	s.newDomain("vm1")
+	s.init()
+	s.harness.Round()
+	s.driver.InjectedErr = errors.New("connection lost")
+	s.harness.Run(3)
+	s.harness.AssertFailed("libvirt")
+	s.Empty(s.harness.Snapshot())
+}
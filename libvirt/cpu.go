@@ -31,6 +31,26 @@ func (col *cpuCollector) Metrics() collector.MetricReaderMap {
 	}
 }
 
+func (col *cpuCollector) MetricRings() collector.MetricRingMap {
+	prefix := col.parent.prefix()
+	return collector.MetricRingMap{
+		prefix + "cpu":        col.cpu_total,
+		prefix + "cpu/user":   col.cpu_user,
+		prefix + "cpu/system": col.cpu_system,
+		prefix + "cpu/virt":   col.cpu_virtual,
+	}
+}
+
+func (col *cpuCollector) MetricsMetadata() collector.MetricMetadataMap {
+	prefix := col.parent.prefix()
+	return collector.MetricMetadataMap{
+		prefix + "cpu":        collector.RateMetric(collector.UnitPercent, "Total CPU utilization of the VM, relative to one CPU core"),
+		prefix + "cpu/user":   collector.RateMetric(collector.UnitPercent, "User CPU utilization of the VM, relative to one CPU core"),
+		prefix + "cpu/system": collector.RateMetric(collector.UnitPercent, "System CPU utilization of the VM, relative to one CPU core"),
+		prefix + "cpu/virt":   collector.RateMetric(collector.UnitPercent, "Virtual CPU utilization of the VM, relative to one CPU core"),
+	}
+}
+
 func (col *cpuCollector) Update() error {
 	if stats, err := col.parent.domain.CpuStats(); err != nil {
 		return err
@@ -67,6 +67,14 @@ func (col *vmBlockIoCollector) Metrics() collector.MetricReaderMap {
 	}
 }
 
+func (col *vmBlockIoCollector) MetricsMetadata() collector.MetricMetadataMap {
+	prefix := col.parent.parent.prefix()
+	return collector.MetricMetadataMap{
+		prefix + "block/io":      collector.RateMetric(collector.UnitPerSecond, "Read and write operations on all block devices of the VM"),
+		prefix + "block/ioBytes": collector.RateMetric(collector.UnitBytesPerSecond, "Read and write throughput on all block devices of the VM"),
+	}
+}
+
 func (col *vmBlockIoCollector) Update() error {
 	new_stats := make([]VirDomainBlockStats, 0, len(col.parent.devices))
 	for _, dev := range col.parent.devices {
@@ -85,6 +93,10 @@ func (col *vmBlockIoCollector) Depends() []collector.Collector {
 	return []collector.Collector{col.parent}
 }
 
+func (col *vmBlockIoCollector) Entity() *collector.MetricEntity {
+	return col.parent.Entity()
+}
+
 func (col *vmBlockIoCollector) readIo() bitflow.Value {
 	var result bitflow.Value
 	for _, stats := range col.stats {
@@ -120,6 +132,15 @@ func (col *vmBlockStatsCollector) Metrics() collector.MetricReaderMap {
 	}
 }
 
+func (col *vmBlockStatsCollector) MetricsMetadata() collector.MetricMetadataMap {
+	prefix := col.parent.parent.prefix()
+	return collector.MetricMetadataMap{
+		prefix + "block/allocation": collector.GaugeMetric(collector.UnitBytes, "Allocated space of all block devices of the VM"),
+		prefix + "block/capacity":   collector.GaugeMetric(collector.UnitBytes, "Logical capacity of all block devices of the VM"),
+		prefix + "block/physical":   collector.GaugeMetric(collector.UnitBytes, "Physical size of all block devices of the VM"),
+	}
+}
+
 func (col *vmBlockStatsCollector) Update() error {
 	new_info := make([]VirDomainBlockInfo, 0, len(col.parent.devices))
 	for _, dev := range col.parent.devices {
@@ -137,6 +158,10 @@ func (col *vmBlockStatsCollector) Depends() []collector.Collector {
 	return []collector.Collector{col.parent}
 }
 
+func (col *vmBlockStatsCollector) Entity() *collector.MetricEntity {
+	return col.parent.Entity()
+}
+
 func (col *vmBlockStatsCollector) readAllocation() (result bitflow.Value) {
 	for _, info := range col.info {
 		result += bitflow.Value(info.Allocation)
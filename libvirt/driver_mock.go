@@ -2,7 +2,10 @@
 
 package libvirt
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var _ Driver = new(MockDriver)
 var _ Domain = new(MockDomain)
@@ -14,6 +17,9 @@ func NewDriver() Driver {
 type MockDriver struct {
 	uri         string
 	InjectedErr error
+
+	// Domains are returned by ListDomains(). Their fields can be modified to simulate changing statistics.
+	Domains []*MockDomain
 }
 
 func (d *MockDriver) Connect(uri string) error {
@@ -28,7 +34,12 @@ func (d *MockDriver) ListDomains() ([]Domain, error) {
 	if err := d.err(); err != nil {
 		return nil, err
 	}
-	return nil, nil
+	res := make([]Domain, len(d.Domains))
+	for i, domain := range d.Domains {
+		domain.driver = d
+		res[i] = domain
+	}
+	return res, nil
 }
 
 func (d *MockDriver) Close() error {
@@ -43,8 +54,21 @@ func (d *MockDriver) err() error {
 	return d.InjectedErr
 }
 
+// MockDomainXML is used as XML description of MockDomains that do not define one
+const MockDomainXML = "<domain></domain>"
+
 type MockDomain struct {
 	driver *MockDriver
+
+	Name       string
+	XML        string
+	Info       DomainInfo
+	Cpu        VirDomainCpuStats
+	Memory     VirDomainMemoryStat
+	Blocks     map[string]VirDomainBlockStats
+	BlockInfos map[string]VirDomainBlockInfo
+	Interfaces map[string]VirDomainInterfaceStats
+	Volumes    []VolumeInfo
 }
 
 func (d *MockDomain) err() error {
@@ -52,37 +76,61 @@ func (d *MockDomain) err() error {
 }
 
 func (d *MockDomain) GetXML() (string, error) {
-	return "", d.err()
+	if d.XML == "" {
+		return MockDomainXML, d.err()
+	}
+	return d.XML, d.err()
 }
 
 func (d *MockDomain) GetInfo() (DomainInfo, error) {
-	return DomainInfo{}, d.err()
+	return d.Info, d.err()
 }
 
 func (d *MockDomain) GetName() (string, error) {
-	return "", d.err()
+	return d.Name, d.err()
 }
 
 func (d *MockDomain) CpuStats() (VirDomainCpuStats, error) {
-	return VirDomainCpuStats{}, d.err()
+	return d.Cpu, d.err()
 }
 
-func (d *MockDomain) BlockStats(_ string) (VirDomainBlockStats, error) {
-	return VirDomainBlockStats{}, d.err()
+func (d *MockDomain) BlockStats(dev string) (VirDomainBlockStats, error) {
+	if err := d.err(); err != nil {
+		return VirDomainBlockStats{}, err
+	}
+	stats, ok := d.Blocks[dev]
+	if !ok {
+		return stats, fmt.Errorf("MockDomain %v: no block device %v", d.Name, dev)
+	}
+	return stats, nil
 }
 
-func (d *MockDomain) BlockInfo(_ string) (VirDomainBlockInfo, error) {
-	return VirDomainBlockInfo{}, d.err()
+func (d *MockDomain) BlockInfo(dev string) (VirDomainBlockInfo, error) {
+	if err := d.err(); err != nil {
+		return VirDomainBlockInfo{}, err
+	}
+	info, ok := d.BlockInfos[dev]
+	if !ok {
+		return info, fmt.Errorf("MockDomain %v: no block device %v", d.Name, dev)
+	}
+	return info, nil
 }
 
 func (d *MockDomain) MemoryStats() (VirDomainMemoryStat, error) {
-	return VirDomainMemoryStat{}, d.err()
+	return d.Memory, d.err()
 }
 
-func (d *MockDomain) InterfaceStats(_ string) (VirDomainInterfaceStats, error) {
-	return VirDomainInterfaceStats{}, d.err()
+func (d *MockDomain) InterfaceStats(interfaceName string) (VirDomainInterfaceStats, error) {
+	if err := d.err(); err != nil {
+		return VirDomainInterfaceStats{}, err
+	}
+	stats, ok := d.Interfaces[interfaceName]
+	if !ok {
+		return stats, fmt.Errorf("MockDomain %v: no interface %v", d.Name, interfaceName)
+	}
+	return stats, nil
 }
 
 func (d *MockDomain) GetVolumeInfo() ([]VolumeInfo, error) {
-	return nil, d.err()
+	return d.Volumes, d.err()
 }
@@ -26,6 +26,15 @@ func (col *memoryStatCollector) Metrics() collector.MetricReaderMap {
 	}
 }
 
+func (col *memoryStatCollector) MetricsMetadata() collector.MetricMetadataMap {
+	prefix := col.parent.prefix()
+	return collector.MetricMetadataMap{
+		prefix + "mem/available": collector.GaugeMetric(collector.UnitKibiBytes, "Memory available to the VM guest"),
+		prefix + "mem/used":      collector.GaugeMetric(collector.UnitKibiBytes, "Memory used inside the VM guest"),
+		prefix + "mem/percent":   collector.GaugeMetric(collector.UnitPercent, "Percentage of used memory inside the VM guest"),
+	}
+}
+
 func (col *memoryStatCollector) Update() error {
 	if memStats, err := col.parent.domain.MemoryStats(); err != nil {
 		return err
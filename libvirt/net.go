@@ -27,22 +27,40 @@ func (col *interfaceStatCollector) Metrics() collector.MetricReaderMap {
 	return col.net.Metrics(col.parent.prefix() + "net-io")
 }
 
+func (col *interfaceStatCollector) MetricRings() collector.MetricRingMap {
+	return col.net.Rings(col.parent.prefix() + "net-io")
+}
+
+func (col *interfaceStatCollector) MetricsMetadata() collector.MetricMetadataMap {
+	return col.net.Metadata(col.parent.prefix() + "net-io")
+}
+
 func (col *interfaceStatCollector) Update() error {
+	// Sum up the counters of all interfaces. The rings are only modified if the stats of all interfaces are available.
+	var sum VirDomainInterfaceStats
 	for _, interfaceName := range col.interfaces {
 		// More detailed alternative: domain.GetInterfaceParameters()
 		stats, err := col.parent.domain.InterfaceStats(interfaceName)
 		if err != nil {
 			return fmt.Errorf("VM %v to update vNIC stats for %s: %v", col.parent.name, interfaceName, err)
 		}
-		col.net.Bytes.Add(collector.StoredValue(stats.RxBytes + stats.TxBytes))
-		col.net.Packets.Add(collector.StoredValue(stats.RxPackets + stats.TxPackets))
-		col.net.RxBytes.Add(collector.StoredValue(stats.RxBytes))
-		col.net.RxPackets.Add(collector.StoredValue(stats.RxPackets))
-		col.net.TxBytes.Add(collector.StoredValue(stats.TxBytes))
-		col.net.TxPackets.Add(collector.StoredValue(stats.TxPackets))
-		col.net.Errors.Add(collector.StoredValue(stats.RxErrs + stats.TxErrs))
-		col.net.Dropped.Add(collector.StoredValue(stats.RxDrop + stats.TxDrop))
+		sum.RxBytes += stats.RxBytes
+		sum.RxPackets += stats.RxPackets
+		sum.RxErrs += stats.RxErrs
+		sum.RxDrop += stats.RxDrop
+		sum.TxBytes += stats.TxBytes
+		sum.TxPackets += stats.TxPackets
+		sum.TxErrs += stats.TxErrs
+		sum.TxDrop += stats.TxDrop
 	}
+	col.net.Bytes.Add(collector.Counter64(sum.RxBytes + sum.TxBytes))
+	col.net.Packets.Add(collector.Counter64(sum.RxPackets + sum.TxPackets))
+	col.net.RxBytes.Add(collector.Counter64(sum.RxBytes))
+	col.net.RxPackets.Add(collector.Counter64(sum.RxPackets))
+	col.net.TxBytes.Add(collector.Counter64(sum.TxBytes))
+	col.net.TxPackets.Add(collector.Counter64(sum.TxPackets))
+	col.net.Errors.Add(collector.Counter64(sum.RxErrs + sum.TxErrs))
+	col.net.Dropped.Add(collector.Counter64(sum.RxDrop + sum.TxDrop))
 	return nil
 }
 
@@ -8,21 +8,30 @@ import (
 	"gopkg.in/xmlpath.v1"
 )
 
+// VmTag is the tag key identifying the virtual machine in tagged samples
+const VmTag = "vm"
+
 type vmCollector struct {
 	collector.AbstractCollector
 	parent        *Collector
 	name          string
 	domain        Domain
 	subCollectors []vmSubCollector
+	entity        *collector.MetricEntity
 }
 
 func (parent *Collector) newVmCollector(name string, domain Domain) *vmCollector {
-	return &vmCollector{
+	col := &vmCollector{
 		AbstractCollector: parent.Child(name),
 		parent:            parent,
 		name:              name,
 		domain:            domain,
 	}
+	col.entity = &collector.MetricEntity{
+		Prefix: col.prefix(),
+		Tags:   map[string]string{VmTag: name},
+	}
+	return col
 }
 
 func (col *vmCollector) Init() ([]collector.Collector, error) {
@@ -59,6 +68,10 @@ func (col *vmCollector) Depends() []collector.Collector {
 	return []collector.Collector{col.parent}
 }
 
+func (col *vmCollector) Entity() *collector.MetricEntity {
+	return col.entity
+}
+
 func (col *vmCollector) prefix() string {
 	return "libvirt/" + col.Name + "/"
 }
@@ -77,6 +90,10 @@ func (col *vmSubCollectorImpl) Depends() []collector.Collector {
 	return []collector.Collector{col.parent}
 }
 
+func (col *vmSubCollectorImpl) Entity() *collector.MetricEntity {
+	return col.parent.entity
+}
+
 func (col *vmSubCollectorImpl) description(xmlDesc *xmlpath.Node) {
 }
 
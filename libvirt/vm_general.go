@@ -30,6 +30,21 @@ func (col *vmGeneralCollector) Metrics() collector.MetricReaderMap {
 	}
 }
 
+func (col *vmGeneralCollector) MetricRings() collector.MetricRingMap {
+	return collector.MetricRingMap{
+		col.parent.prefix() + "general/cpu": col.cpu,
+	}
+}
+
+func (col *vmGeneralCollector) MetricsMetadata() collector.MetricMetadataMap {
+	prefix := col.parent.prefix()
+	return collector.MetricMetadataMap{
+		prefix + "general/cpu":    collector.RateMetric(collector.UnitPercent, "CPU utilization of the VM, relative to one CPU core"),
+		prefix + "general/maxMem": collector.GaugeMetric(collector.UnitKibiBytes, "Maximum memory of the VM"),
+		prefix + "general/mem":    collector.GaugeMetric(collector.UnitKibiBytes, "Memory currently assigned to the VM"),
+	}
+}
+
 func (col *vmGeneralCollector) Update() (err error) {
 	col.info, err = col.parent.domain.GetInfo()
 	if err == nil {
@@ -46,8 +61,17 @@ func (col *vmGeneralCollector) readMem() bitflow.Value {
 	return bitflow.Value(col.info.Mem)
 }
 
+// LogbackCpuVal is the CPU time of a VM in nanoseconds. It is reset when the VM is rebooted.
 type LogbackCpuVal uint64
 
+func (val LogbackCpuVal) CounterWidth() uint {
+	return 64
+}
+
+func (val LogbackCpuVal) CounterValue() uint64 {
+	return uint64(val)
+}
+
 func (val LogbackCpuVal) DiffValue(logback collector.LogbackValue, interval time.Duration) bitflow.Value {
 	switch previous := logback.(type) {
 	case LogbackCpuVal:
@@ -0,0 +1,33 @@
+package collector
+
+import (
+	"time"
+
+	"github.com/bitflow-stream/go-bitflow/bitflow"
+)
+
+// MeasurementTimeTag is attached to samples if SampleSource.TagMeasurementTime is set. It contains the time when the
+// least recently updated collector contributing to the sample finished its last successful update, in time.RFC3339Nano
+// format. All values of the sample have been measured at that time or later.
+const MeasurementTimeTag = "measurement_time"
+
+// measurementTime returns the oldest measurement of the collectors contributing metrics to the group.
+// Collectors that have not been updated successfully yet are ignored. The result is zero if no collector has been updated.
+func (group *sampleGroup) measurementTime() time.Time {
+	var oldest time.Time
+	for _, node := range group.nodes {
+		node.statsLock.Lock()
+		measurement := node.lastMeasurement
+		node.statsLock.Unlock()
+		if !measurement.IsZero() && (oldest.IsZero() || measurement.Before(oldest)) {
+			oldest = measurement
+		}
+	}
+	return oldest
+}
+
+func setMeasurementTime(sample *bitflow.Sample, measurement time.Time) {
+	if !measurement.IsZero() {
+		sample.SetTag(MeasurementTimeTag, measurement.Format(time.RFC3339Nano))
+	}
+}
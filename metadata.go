@@ -0,0 +1,97 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MetricKind describes how the value of a metric should be interpreted.
+type MetricKind int
+
+const (
+	// UnknownKind is the zero value, used when the kind of a metric has not been specified.
+	UnknownKind MetricKind = iota
+
+	// Gauge metrics represent a current absolute value, like used memory.
+	Gauge
+
+	// Rate metrics are derived from a monotonic counter through a ValueRing and represent
+	// the change of the counter per time unit, like received bytes per second.
+	Rate
+
+	// Counter metrics represent a monotonically increasing value.
+	Counter
+)
+
+var metricKindNames = map[MetricKind]string{
+	UnknownKind: "unknown",
+	Gauge:       "gauge",
+	Rate:        "rate",
+	Counter:     "counter",
+}
+
+func (kind MetricKind) String() string {
+	if name, ok := metricKindNames[kind]; ok {
+		return name
+	}
+	return fmt.Sprintf("MetricKind(%v)", int(kind))
+}
+
+func (kind MetricKind) MarshalText() ([]byte, error) {
+	return []byte(kind.String()), nil
+}
+
+// Commonly used metric units
+const (
+	UnitPercent          = "percent"
+	UnitBytes            = "bytes"
+	UnitKibiBytes        = "KiB"
+	UnitBytesPerSecond   = "bytes/s"
+	UnitPacketsPerSecond = "packets/s"
+	UnitPerSecond        = "1/s"
+	UnitSecondsPerSecond = "s/s"
+	UnitMillisPerSecond  = "ms/s"
+	UnitMillis           = "ms"
+	UnitCount            = "count"
+)
+
+// MetricMetadata describes the semantics of a metric. All fields are optional.
+type MetricMetadata struct {
+	Kind        MetricKind `json:"kind,omitempty"`
+	Unit        string     `json:"unit,omitempty"`
+	Description string     `json:"description,omitempty"`
+}
+
+func GaugeMetric(unit string, description string) MetricMetadata {
+	return MetricMetadata{Kind: Gauge, Unit: unit, Description: description}
+}
+
+func RateMetric(unit string, description string) MetricMetadata {
+	return MetricMetadata{Kind: Rate, Unit: unit, Description: description}
+}
+
+func CounterMetric(unit string, description string) MetricMetadata {
+	return MetricMetadata{Kind: Counter, Unit: unit, Description: description}
+}
+
+func (meta MetricMetadata) String() string {
+	var res strings.Builder
+	res.WriteString(meta.Kind.String())
+	if meta.Unit != "" {
+		res.WriteString(", " + meta.Unit)
+	}
+	if meta.Description != "" {
+		res.WriteString(": " + meta.Description)
+	}
+	return res.String()
+}
+
+// MetricMetadataMap contains the metadata of metrics, stored under the same keys as in the MetricReaderMap.
+type MetricMetadataMap map[string]MetricMetadata
+
+// DescribedCollector can optionally be implemented by a Collector to describe its metrics.
+// MetricsMetadata() is called after Init() returned successfully. It does not need to
+// describe all metrics returned from Metrics().
+type DescribedCollector interface {
+	MetricsMetadata() MetricMetadataMap
+}
@@ -0,0 +1,73 @@
+package collector
+
+import (
+	"regexp"
+
+	"github.com/bitflow-stream/go-bitflow/bitflow"
+)
+
+// valuesMissing returns true if the current metric values of the node are unknown: either its last Update() failed,
+// or the node has failed entirely or has been removed because of a failed dependency.
+func (node *collectorNode) valuesMissing() bool {
+	if state, _ := node.graph.nodeState(node); state != CollectorActive {
+		return true
+	}
+	node.statsLock.Lock()
+	defer node.statsLock.Unlock()
+	return node.lastUpdateFailed
+}
+
+// readMissingAsNaN makes the metrics return NaN instead of their last value while the values
+// of their collectors are missing, see SampleSource.MissingValuesAsNaN.
+func (s MetricSlice) readMissingAsNaN() {
+	for _, metric := range s {
+		node := metric.node
+		if node == nil {
+			continue
+		}
+		reader := metric.reader
+		metric.reader = func() bitflow.Value {
+			if node.valuesMissing() {
+				return readNaN()
+			}
+			return reader()
+		}
+	}
+}
+
+// getMissingNodes returns the initialized nodes that have failed, or that have been removed because one of their
+// dependencies has failed. The metric filters are applied to these nodes, and nodes without metrics are omitted.
+// Collectors that failed in their Init() are not included, since their metrics are unknown.
+func (g *collectorGraph) getMissingNodes(exclude []*regexp.Regexp, include []*regexp.Regexp) map[*collectorNode]bool {
+	failedDependency := make(map[*collectorNode]bool)
+	var dependsOnFailed func(node *collectorNode) bool
+	dependsOnFailed = func(node *collectorNode) bool {
+		if result, ok := failedDependency[node]; ok {
+			return result
+		}
+		result := false
+		for _, dependsCol := range node.collector.Depends() {
+			depends := g.resolve(dependsCol)
+			if g.failed[depends] || dependsOnFailed(depends) {
+				result = true
+				break
+			}
+		}
+		failedDependency[node] = result
+		return result
+	}
+
+	missing := make(map[*collectorNode]bool)
+	for _, node := range g.collectors {
+		if g.nodes[node] || g.filtered[node] || !node.isInitialized() {
+			continue
+		}
+		if g.failed[node] || dependsOnFailed(node) {
+			node.applyMetricFilters(exclude, include)
+			if len(node.metrics) > 0 {
+				missing[node] = true
+			}
+		}
+	}
+	return missing
+}
@@ -0,0 +1,120 @@
+package collector
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/antongulenko/golib"
+	"github.com/bitflow-stream/go-bitflow/bitflow"
+	"github.com/stretchr/testify/suite"
+)
+
+type initFailingCollector struct {
+	testCollector
+}
+
+func (col *initFailingCollector) Init() ([]Collector, error) {
+	return nil, errors.New("init failed")
+}
+
+type MissingValuesTestSuite struct {
+	golib.AbstractTestSuite
+	clock *FakeClock
+}
+
+func TestMissingValues(t *testing.T) {
+	suite.Run(t, new(MissingValuesTestSuite))
+}
+
+func (suite *MissingValuesTestSuite) SetupTest() {
+	suite.clock = NewFakeClock(time.Unix(1000, 0))
+}
+
+func (suite *MissingValuesTestSuite) newGraph(cols ...Collector) *collectorGraph {
+	graph, err := initCollectorGraph(cols)
+	suite.NoError(err)
+	graph = graph.clone()
+	graph.clock = suite.clock
+	graph.pruneAndRepair()
+	graph.applyRetryPolicies(RetryPolicy{ToleratedFailures: 2}, nil, time.Second)
+	return graph
+}
+
+func (suite *MissingValuesTestSuite) read(metrics MetricSlice) map[string]bitflow.Value {
+	res := make(map[string]bitflow.Value)
+	for _, metric := range metrics {
+		res[metric.name] = metric.reader()
+	}
+	return res
+}
+
+func (suite *MissingValuesTestSuite) assertNaN(values map[string]bitflow.Value, names ...string) {
+	for _, name := range names {
+		value, ok := values[name]
+		suite.True(ok, name)
+		suite.True(math.IsNaN(float64(value)), name)
+	}
+}
+
+func (suite *MissingValuesTestSuite) TestFailedUpdates() {
+	root := &dependentCollector{testCollector: testCollector{AbstractCollector: RootCollector("root")}, log: new(updateLog)}
+	child := &dependentCollector{testCollector: testCollector{AbstractCollector: RootCollector("child")}, log: new(updateLog), depends: []Collector{root}}
+	other := newTestCollector("other")
+	graph := suite.newGraph(root, child, other)
+	metrics := graph.getMetrics()
+	metrics.readMissingAsNaN()
+	stopper := golib.NewStopChan()
+	rootNode := graph.collectors[root]
+
+	suite.True(rootNode.update(stopper))
+	suite.Equal(map[string]bitflow.Value{"root": 1, "child": 1, "other": 1}, suite.read(metrics))
+
+	// A tolerated failure makes the values unknown until the next successful update
+	root.setError(errors.New("update failed"))
+	suite.True(rootNode.update(stopper))
+	values := suite.read(metrics)
+	suite.assertNaN(values, "root")
+	suite.Equal(bitflow.Value(1), values["child"])
+	root.setError(nil)
+	suite.True(rootNode.update(stopper))
+	suite.Equal(bitflow.Value(1), suite.read(metrics)["root"])
+
+	// After the collector has failed, its metrics and the metrics of its dependents are unknown
+	root.setError(errors.New("update failed"))
+	suite.True(rootNode.update(stopper))
+	suite.False(rootNode.update(stopper))
+	values = suite.read(metrics)
+	suite.assertNaN(values, "root", "child")
+	suite.Equal(bitflow.Value(1), values["other"])
+
+	// The failed collector and its dependents keep their metrics in the next collection round
+	next := graph.clone()
+	next.pruneAndRepair()
+	missing := next.getMissingNodes(nil, nil)
+	suite.Equal(map[*collectorNode]bool{rootNode: true, next.collectors[child]: true}, missing)
+	nextMetrics := append(next.getMetrics(), getMetrics(missing)...)
+	nextMetrics.readMissingAsNaN()
+	values = suite.read(nextMetrics)
+	suite.Len(values, 3)
+	suite.assertNaN(values, "root", "child")
+	suite.Equal(bitflow.Value(1), values["other"])
+}
+
+func (suite *MissingValuesTestSuite) TestMissingNodesFiltered() {
+	failing := newTestCollector("failing")
+	failing.setError(errors.New("update failed"))
+	initFailing := &initFailingCollector{testCollector{AbstractCollector: RootCollector("init-failing")}}
+	graph := suite.newGraph(failing, initFailing, newTestCollector("other"))
+	stopper := golib.NewStopChan()
+	node := graph.collectors[failing]
+	node.update(stopper)
+	node.update(stopper)
+
+	// Collectors that failed in Init() have no known metrics, and the metric filters apply to the failed collectors
+	next := graph.clone()
+	suite.Equal(map[*collectorNode]bool{node: true}, next.getMissingNodes(nil, nil))
+	suite.Empty(next.getMissingNodes([]*regexp.Regexp{regexp.MustCompile("^failing$")}, nil))
+}
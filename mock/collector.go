@@ -16,6 +16,13 @@ const _max_mock_val = 200
 
 func init() {
 	rand.Seed(int64(time.Now().Nanosecond()))
+	collector.RegisterCollector(&collector.CollectorFactory{
+		Name:        "mock",
+		Description: "Randomly generated metrics for testing",
+		New: func(_ collector.CollectorParameters, factory *collector.ValueRingFactory) ([]collector.Collector, error) {
+			return []collector.Collector{NewMockCollector(factory)}, nil
+		},
+	})
 }
 
 func NewMockCollector(factory *collector.ValueRingFactory) collector.Collector {
@@ -98,6 +105,18 @@ func (col *Collector) Metrics() collector.MetricReaderMap {
 	}
 }
 
+func (col *Collector) MetricRings() collector.MetricRingMap {
+	return collector.MetricRingMap{
+		fmt.Sprintf("mock/%v", col.factor): col.ring,
+	}
+}
+
+func (col *Collector) MetricsMetadata() collector.MetricMetadataMap {
+	return collector.MetricMetadataMap{
+		fmt.Sprintf("mock/%v", col.factor): collector.RateMetric(collector.UnitPerSecond, "Randomly incremented mock counter"),
+	}
+}
+
 func (col *Collector) Depends() []collector.Collector {
 	return []collector.Collector{col.root}
 }
@@ -3,6 +3,7 @@ package ovsdb
 import (
 	"errors"
 	"fmt"
+	"strconv"
 	"sync"
 
 	"github.com/bitflow-stream/go-bitflow-collector"
@@ -18,29 +19,49 @@ type Collector struct {
 	factory *collector.ValueRingFactory
 
 	client              *libovsdb.OvsdbClient
+	connect             func() (*libovsdb.TableUpdates, *libovsdb.OvsdbClient, error) // Replaced in tests
 	lastUpdateError     error
 	notifier            ovsdbNotifier
 	interfaceCollectors map[string]*ovsdbInterfaceCollector
 	readersLock         sync.Mutex
 }
 
+func init() {
+	collector.RegisterCollector(&collector.CollectorFactory{
+		Name:        "ovsdb",
+		Description: "Metrics of Open vSwitch interfaces, received through the OVSDB protocol",
+		Parameters: []collector.FactoryParameter{
+			{Name: "host", Type: collector.StringParameter, Description: "OVSDB host to connect to, empty for localhost"},
+			{Name: "port", Type: collector.IntParameter, Default: strconv.Itoa(DefaultOvsdbPort), Description: "OVSDB port"},
+		},
+		New: func(params collector.CollectorParameters, factory *collector.ValueRingFactory) ([]collector.Collector, error) {
+			return []collector.Collector{NewOvsdbCollectorPort(params.String("host"), params.Int("port"), factory)}, nil
+		},
+	})
+}
+
 func NewOvsdbCollector(host string, factory *collector.ValueRingFactory) *Collector {
 	return NewOvsdbCollectorPort(host, 0, factory)
 }
 
 func NewOvsdbCollectorPort(host string, port int, factory *collector.ValueRingFactory) *Collector {
-	return &Collector{
+	col := &Collector{
 		AbstractCollector: collector.RootCollector("ovsdb"),
 		Host:              host,
 		Port:              port,
 		factory:           factory}
+	col.connect = col.openConnection
+	return col
 }
 
 func (parent *Collector) Init() ([]collector.Collector, error) {
 	parent.Close()
 	parent.notifier.col = parent
 	parent.lastUpdateError = nil
-	parent.interfaceCollectors = make(map[string]*ovsdbInterfaceCollector)
+	if parent.interfaceCollectors == nil {
+		// The collectors of known interfaces are reused by later calls to Init(), so that their rings keep their values
+		parent.interfaceCollectors = make(map[string]*ovsdbInterfaceCollector)
+	}
 	if err := parent.update(false); err != nil {
 		return nil, err
 	}
@@ -80,7 +101,7 @@ func (parent *Collector) update(checkChange bool) error {
 
 func (parent *Collector) ensureConnection(checkChange bool) error {
 	if parent.client == nil {
-		initialTables, ovs, err := parent.openConnection()
+		initialTables, ovs, err := parent.connect()
 		if err == nil {
 			parent.client = ovs
 			return parent.updateTables(checkChange, initialTables.Updates)
@@ -140,6 +161,15 @@ func (parent *Collector) updateTables(checkChange bool, updates map[string]libov
 		}
 	}
 
+	if !checkChange {
+		// The initial table contents include all interfaces, drop the collectors of removed interfaces
+		for name := range parent.interfaceCollectors {
+			if !updatedInterfaces[name] {
+				delete(parent.interfaceCollectors, name)
+			}
+		}
+	}
+
 	// TODO regularly check, if one of the observed interfaces does not exist anymore
 	// Not every updated includes all interfaces.
 	return nil
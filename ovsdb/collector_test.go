@@ -0,0 +1,139 @@
+package ovsdb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/antongulenko/golib"
+	"github.com/bitflow-stream/go-bitflow-collector/collectortest"
+	"github.com/socketplane/libovsdb"
+	"github.com/stretchr/testify/suite"
+)
+
+type OvsdbTestSuite struct {
+	golib.AbstractTestSuite
+	harness *collectortest.Harness
+	col     *Collector
+
+	// Interface name -> statistics, returned as the content of the Interface table
+	interfaces map[string]map[string]float64
+	connectErr error
+}
+
+func TestOvsdbCollector(t *testing.T) {
+	suite.Run(t, new(OvsdbTestSuite))
+}
+
+func (s *OvsdbTestSuite) SetupTest() {
+	s.harness = collectortest.New(s.T())
+	s.interfaces = make(map[string]map[string]float64)
+	s.connectErr = nil
+	s.col = NewOvsdbCollector("", s.harness.Factory)
+	// Without a client, the connection is opened again on every update, which returns the current table contents
+	s.col.connect = func() (*libovsdb.TableUpdates, *libovsdb.OvsdbClient, error) {
+		if s.connectErr != nil {
+			return nil, nil, s.connectErr
+		}
+		return s.tableUpdates(), nil, nil
+	}
+}
+
+func (s *OvsdbTestSuite) tableUpdates() *libovsdb.TableUpdates {
+	rows := make(map[string]libovsdb.RowUpdate)
+	for name, stats := range s.interfaces {
+		statMap := make(map[interface{}]interface{})
+		for key, val := range stats {
+			statMap[key] = val
+		}
+		rows[name] = libovsdb.RowUpdate{New: libovsdb.Row{Fields: map[string]interface{}{
+			"name":       name,
+			"statistics": libovsdb.OvsMap{GoMap: statMap},
+		}}}
+	}
+	return &libovsdb.TableUpdates{Updates: map[string]libovsdb.TableUpdate{
+		"Interface": {Rows: rows},
+	}}
+}
+
+// advance simulates every interface receiving 1000 and sending 500 bytes per second
+func (s *OvsdbTestSuite) advance() {
+	seconds := s.harness.Interval.Seconds()
+	for _, stats := range s.interfaces {
+		stats["rx_bytes"] += 1000 * seconds
+		stats["tx_bytes"] += 500 * seconds
+		stats["rx_packets"] += 10 * seconds
+	}
+}
+
+func (s *OvsdbTestSuite) TestConnectionError() {
+	s.connectErr = errors.New("connection refused")
+	s.Error(s.harness.TryInit(s.col))
+}
+
+func (s *OvsdbTestSuite) TestInterfaceMetrics() {
+	s.interfaces["eth0"] = make(map[string]float64)
+	s.harness.Init(s.col)
+	for i := 0; i < 5; i++ {
+		s.advance()
+		s.harness.Round()
+	}
+	s.harness.AssertNotFailed()
+	s.harness.AssertMetricsMatch("^ovsdb/eth0/")
+	s.harness.AssertMetadata()
+	s.harness.AssertValue("ovsdb/eth0/rx_bytes", 1000)
+	s.harness.AssertValue("ovsdb/eth0/tx_bytes", 500)
+	s.harness.AssertValue("ovsdb/eth0/bytes", 1500)
+	s.harness.AssertValue("ovsdb/eth0/rx_packets", 10)
+	s.harness.AssertValue("ovsdb/eth0/errors", 0)
+}
+
+func (s *OvsdbTestSuite) TestNewInterface() {
+	s.interfaces["eth0"] = make(map[string]float64)
+	s.harness.Init(s.col)
+	s.harness.Run(2)
+	s.harness.AssertNoMetrics("ovsdb/eth1/bytes")
+
+	s.interfaces["eth1"] = make(map[string]float64)
+	s.harness.Round()
+	s.harness.AssertMetricsChanged("ovsdb")
+	s.harness.Round()
+	s.harness.AssertNotFailed()
+	s.harness.AssertMetrics("ovsdb/eth0/bytes", "ovsdb/eth1/bytes")
+}
+
+func (s *OvsdbTestSuite) TestNewInterfaceKeepsRings() {
+	s.interfaces["eth0"] = make(map[string]float64)
+	s.interfaces["eth1"] = make(map[string]float64)
+	s.harness.Init(s.col)
+	for i := 0; i < 3; i++ {
+		s.advance()
+		s.harness.Round()
+	}
+	s.harness.AssertValue("ovsdb/eth0/rx_bytes", 1000)
+	eth0 := s.col.interfaceCollectors["eth0"]
+
+	delete(s.interfaces, "eth1")
+	s.interfaces["eth2"] = make(map[string]float64)
+	s.advance()
+	s.harness.Round()
+	s.harness.AssertMetricsChanged("ovsdb")
+
+	// The collector of eth0 is reused, so its rings keep the values from before the restart
+	s.advance()
+	s.harness.Round()
+	s.harness.AssertNotFailed()
+	s.harness.AssertMetricsMatch("^ovsdb/eth[02]/")
+	s.harness.AssertNoMetrics("ovsdb/eth1/bytes")
+	s.harness.AssertValue("ovsdb/eth0/rx_bytes", 1000)
+	s.True(eth0 == s.col.interfaceCollectors["eth0"], "the collector of eth0 should be reused")
+	s.NotContains(s.col.interfaceCollectors, "eth1")
+}
+
+func (s *OvsdbTestSuite) TestLostConnection() {
+	s.interfaces["eth0"] = make(map[string]float64)
+	s.harness.Init(s.col)
+	s.harness.Round()
+	s.connectErr = errors.New("connection lost")
+	s.harness.Run(3)
+	s.harness.AssertFailed("ovsdb")
+}
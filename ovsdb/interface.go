@@ -5,22 +5,47 @@ import (
 	"github.com/bitflow-stream/go-bitflow-collector/psutil"
 )
 
+// InterfaceTag is the tag key identifying the OVSDB interface in tagged samples
+const InterfaceTag = "interface"
+
 type ovsdbInterfaceCollector struct {
 	collector.AbstractCollector
 	parent   *Collector
 	counters psutil.NetIoCounters
+	entity   *collector.MetricEntity
 }
 
 func (parent *Collector) newCollector(name string) *ovsdbInterfaceCollector {
-	return &ovsdbInterfaceCollector{
+	col := &ovsdbInterfaceCollector{
 		AbstractCollector: parent.Child(name),
 		parent:            parent,
 		counters:          psutil.NewNetIoCounters(parent.factory),
 	}
+	col.entity = &collector.MetricEntity{
+		Prefix: col.prefix() + "/",
+		Tags:   map[string]string{InterfaceTag: name},
+	}
+	return col
+}
+
+func (col *ovsdbInterfaceCollector) prefix() string {
+	return "ovsdb/" + col.Name
 }
 
 func (col *ovsdbInterfaceCollector) Metrics() collector.MetricReaderMap {
-	return col.counters.Metrics("ovsdb/" + col.Name)
+	return col.counters.Metrics(col.prefix())
+}
+
+func (col *ovsdbInterfaceCollector) MetricRings() collector.MetricRingMap {
+	return col.counters.Rings(col.prefix())
+}
+
+func (col *ovsdbInterfaceCollector) MetricsMetadata() collector.MetricMetadataMap {
+	return col.counters.Metadata(col.prefix())
+}
+
+func (col *ovsdbInterfaceCollector) Entity() *collector.MetricEntity {
+	return col.entity
 }
 
 func (col *ovsdbInterfaceCollector) Depends() []collector.Collector {
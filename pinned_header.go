@@ -0,0 +1,54 @@
+package collector
+
+import (
+	"math"
+	"sort"
+
+	"github.com/bitflow-stream/go-bitflow/bitflow"
+	log "github.com/sirupsen/logrus"
+)
+
+// pinMetrics returns the metrics in the order of the PinnedHeader. Pinned fields without a corresponding metric
+// return NaN, and metrics that are not part of the PinnedHeader are dropped. With PinFirstHeader,
+// the PinnedHeader is initialized with the given metrics.
+func (source *SampleSource) pinMetrics(metrics MetricSlice) MetricSlice {
+	if len(source.PinnedHeader) == 0 {
+		if !source.PinFirstHeader {
+			return metrics
+		}
+		source.PinnedHeader = metrics.names()
+		log.Println("Pinning the header with", len(source.PinnedHeader), "fields")
+	}
+
+	byName := make(map[string]*Metric, len(metrics))
+	for _, metric := range metrics {
+		byName[metric.name] = metric
+	}
+	pinned := make(MetricSlice, len(source.PinnedHeader))
+	var missing []string
+	for i, field := range source.PinnedHeader {
+		if metric, ok := byName[field]; ok {
+			pinned[i] = metric
+			delete(byName, field)
+		} else {
+			pinned[i] = &Metric{name: field, reader: readNaN}
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) > 0 {
+		log.Warnln(len(missing), "fields of the pinned header are not collected and will be NaN:", missing)
+	}
+	if len(byName) > 0 {
+		dropped := make([]string, 0, len(byName))
+		for name := range byName {
+			dropped = append(dropped, name)
+		}
+		sort.Strings(dropped)
+		log.Warnln("Dropping", len(dropped), "metrics that are not part of the pinned header:", dropped)
+	}
+	return pinned
+}
+
+func readNaN() bitflow.Value {
+	return bitflow.Value(math.NaN())
+}
@@ -0,0 +1,68 @@
+package collector
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/antongulenko/golib"
+	"github.com/bitflow-stream/go-bitflow/bitflow"
+	"github.com/stretchr/testify/suite"
+)
+
+type PinnedHeaderTestSuite struct {
+	golib.AbstractTestSuite
+}
+
+func TestPinnedHeader(t *testing.T) {
+	suite.Run(t, new(PinnedHeaderTestSuite))
+}
+
+func (suite *PinnedHeaderTestSuite) metrics(names ...string) MetricSlice {
+	res := make(MetricSlice, len(names))
+	for i, name := range names {
+		res[i] = &Metric{name: name, reader: func() bitflow.Value { return 1 }}
+	}
+	return res
+}
+
+func (suite *PinnedHeaderTestSuite) TestPinnedOrder() {
+	source := &SampleSource{PinnedHeader: []string{"mem", "cpu", "disk"}}
+	metrics := source.pinMetrics(suite.metrics("cpu", "disk", "net", "mem"))
+
+	groups := source.createSampleGroups(metrics)
+	suite.Len(groups, 1)
+	suite.Equal([]string{"mem", "cpu", "disk"}, groups[0].header.Fields)
+	suite.Equal([]bitflow.Value{1, 1, 1}, groups[0].makeSample(time.Unix(1000, 0)).Values)
+}
+
+func (suite *PinnedHeaderTestSuite) TestMissingFields() {
+	source := &SampleSource{PinnedHeader: []string{"cpu", "mem"}}
+	metrics := source.pinMetrics(suite.metrics("cpu"))
+
+	groups := source.createSampleGroups(metrics)
+	suite.Equal([]string{"cpu", "mem"}, groups[0].header.Fields)
+	values := groups[0].makeSample(time.Unix(1000, 0)).Values
+	suite.Equal(bitflow.Value(1), values[0])
+	suite.True(math.IsNaN(float64(values[1])))
+}
+
+func (suite *PinnedHeaderTestSuite) TestPinFirstHeader() {
+	source := &SampleSource{PinFirstHeader: true}
+	metrics := source.pinMetrics(suite.metrics("mem", "cpu"))
+	suite.Equal([]string{"cpu", "mem"}, source.PinnedHeader)
+	suite.Len(metrics, 2)
+
+	// After a restart, the header of the first collection round is kept
+	metrics = source.pinMetrics(suite.metrics("cpu", "net"))
+	groups := source.createSampleGroups(metrics)
+	suite.Equal([]string{"cpu", "mem"}, groups[0].header.Fields)
+}
+
+func (suite *PinnedHeaderTestSuite) TestNotPinned() {
+	source := new(SampleSource)
+	metrics := source.pinMetrics(suite.metrics("mem", "cpu"))
+	suite.Nil(source.PinnedHeader)
+	groups := source.createSampleGroups(metrics)
+	suite.Equal([]string{"cpu", "mem"}, groups[0].header.Fields)
+}
@@ -0,0 +1,73 @@
+package collector
+
+import (
+	"fmt"
+	"plugin"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// PluginSymbol is the name of the symbol that is looked up in collector plugins. It must have the type CollectorPlugin,
+// e.g.: var Plugin collector.CollectorPlugin = new(myPlugin)
+const PluginSymbol = "Plugin"
+
+// CollectorPlugin is implemented by Go plugins (built with -buildmode=plugin) that provide additional collectors.
+// The Init method should register collector factories, which makes them available like the built-in collectors.
+type CollectorPlugin interface {
+	Name() string
+	Init(registry *CollectorRegistry) error
+}
+
+// LoadPlugin opens the Go plugin at the given path and initializes it with the given registry.
+// The collectors registered by the plugin are disabled by default. The name of the loaded plugin is returned.
+func LoadPlugin(registry *CollectorRegistry, path string) (string, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("Failed to load collector plugin %v: %v", path, err)
+	}
+	symbol, err := p.Lookup(PluginSymbol)
+	if err != nil {
+		return "", fmt.Errorf("Collector plugin %v does not define the symbol '%v': %v", path, PluginSymbol, err)
+	}
+	// Lookup() returns a pointer to exported variables
+	pluginPtr, ok := symbol.(*CollectorPlugin)
+	if !ok {
+		return "", fmt.Errorf("Symbol '%v' in collector plugin %v has type %T, expected %T", PluginSymbol, path, symbol, pluginPtr)
+	}
+	loaded := *pluginPtr
+	if loaded == nil {
+		return "", fmt.Errorf("Symbol '%v' in collector plugin %v is nil", PluginSymbol, path)
+	}
+	name := loaded.Name()
+	if err := initPlugin(loaded, registry); err != nil {
+		return "", fmt.Errorf("Failed to initialize collector plugin %v (%v): %v", name, path, err)
+	}
+	log.Debugf("Loaded collector plugin %v from %v", name, path)
+	return name, nil
+}
+
+// initPlugin initializes the plugin and marks the factories it registered as DisabledByDefault, so that collectors
+// of plugins are only used when they are enabled explicitly. If the initialization fails, these factories are removed.
+func initPlugin(p CollectorPlugin, registry *CollectorRegistry) (err error) {
+	existing := make(map[string]bool)
+	for _, factory := range registry.Factories() {
+		existing[factory.Name] = true
+	}
+	defer func() {
+		// CollectorRegistry.Register() panics on duplicate names
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+		for _, factory := range registry.Factories() {
+			if existing[factory.Name] {
+				continue
+			}
+			if err != nil {
+				registry.remove(factory.Name)
+			} else {
+				factory.DisabledByDefault = true
+			}
+		}
+	}()
+	return p.Init(registry)
+}
@@ -0,0 +1,79 @@
+package collector
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/antongulenko/golib"
+	"github.com/stretchr/testify/suite"
+)
+
+// testPlugin registers the given factories, and then fails with err or panics with panicValue, if set
+type testPlugin struct {
+	factories  []*CollectorFactory
+	err        error
+	panicValue interface{}
+}
+
+func (p *testPlugin) Name() string {
+	return "test"
+}
+
+func (p *testPlugin) Init(registry *CollectorRegistry) error {
+	for _, factory := range p.factories {
+		registry.Register(factory)
+	}
+	if p.panicValue != nil {
+		panic(p.panicValue)
+	}
+	return p.err
+}
+
+type PluginTestSuite struct {
+	golib.AbstractTestSuite
+	registry *CollectorRegistry
+}
+
+func TestPlugin(t *testing.T) {
+	suite.Run(t, new(PluginTestSuite))
+}
+
+func (suite *PluginTestSuite) SetupTest() {
+	suite.registry = NewCollectorRegistry()
+	suite.registry.Register(suite.newFactory("builtin"))
+}
+
+func (suite *PluginTestSuite) newFactory(name string) *CollectorFactory {
+	return &CollectorFactory{
+		Name: name,
+		New: func(params CollectorParameters, factory *ValueRingFactory) ([]Collector, error) {
+			return nil, nil
+		},
+	}
+}
+
+func (suite *PluginTestSuite) TestInit() {
+	suite.NoError(initPlugin(&testPlugin{factories: []*CollectorFactory{suite.newFactory("a"), suite.newFactory("b")}}, suite.registry))
+	suite.Len(suite.registry.Factories(), 3)
+	suite.True(suite.registry.Get("a").DisabledByDefault, "plugin collectors must be enabled explicitly")
+	suite.True(suite.registry.Get("b").DisabledByDefault)
+	suite.False(suite.registry.Get("builtin").DisabledByDefault)
+}
+
+func (suite *PluginTestSuite) TestRegistrationConflict() {
+	plugin := &testPlugin{factories: []*CollectorFactory{suite.newFactory("a"), suite.newFactory("builtin")}}
+	suite.EqualError(initPlugin(plugin, suite.registry), "Collector factory 'builtin' registered twice")
+
+	// The factories of the failed plugin are removed, the existing factory is kept
+	suite.Nil(suite.registry.Get("a"))
+	suite.NotNil(suite.registry.Get("builtin"))
+	suite.Len(suite.registry.Factories(), 1)
+}
+
+func (suite *PluginTestSuite) TestFailure() {
+	suite.EqualError(initPlugin(&testPlugin{panicValue: "boom"}, suite.registry), "boom")
+
+	plugin := &testPlugin{factories: []*CollectorFactory{suite.newFactory("a")}, err: errors.New("init failed")}
+	suite.EqualError(initPlugin(plugin, suite.registry), "init failed")
+	suite.Nil(suite.registry.Get("a"))
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/bitflow-stream/go-bitflow-collector"
+	"github.com/bitflow-stream/go-bitflow/bitflow"
+)
+
+func RegisterFileCollector(name string, registry *collector.CollectorRegistry) {
+	registry.Register(&collector.CollectorFactory{
+		Name:        name,
+		Description: "Numeric values read from files, e.g. from the /sys filesystem",
+		Parameters: []collector.FactoryParameter{
+			{Name: "files", Type: collector.ListParameter,
+				Description: "Files to read, as comma-separated name=path pairs. The metrics are named " + name + "/<name>."},
+		},
+		New: func(params collector.CollectorParameters, _ *collector.ValueRingFactory) ([]collector.Collector, error) {
+			col := &FileCollector{
+				AbstractCollector: collector.RootCollector(name),
+			}
+			for _, file := range params.List("files") {
+				parts := strings.SplitN(file, "=", 2)
+				if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+					return nil, fmt.Errorf("Expected name=path, but got '%v'", file)
+				}
+				col.files = append(col.files, &fileValue{name: parts[0], path: parts[1]})
+			}
+			return []collector.Collector{col}, nil
+		},
+	})
+}
+
+type FileCollector struct {
+	collector.AbstractCollector
+	files []*fileValue
+}
+
+type fileValue struct {
+	name  string
+	path  string
+	value bitflow.Value
+}
+
+func (col *FileCollector) Init() ([]collector.Collector, error) {
+	return nil, col.Update()
+}
+
+func (col *FileCollector) Update() error {
+	for _, file := range col.files {
+		content, err := ioutil.ReadFile(file.path)
+		if err != nil {
+			return err
+		}
+		val, err := strconv.ParseFloat(strings.TrimSpace(string(content)), 64)
+		if err != nil {
+			return fmt.Errorf("Failed to parse content of %v: %v", file.path, err)
+		}
+		file.value = bitflow.Value(val)
+	}
+	return nil
+}
+
+func (col *FileCollector) Metrics() collector.MetricReaderMap {
+	res := make(collector.MetricReaderMap, len(col.files))
+	for _, file := range col.files {
+		file := file
+		res[col.String()+"/"+file.name] = func() bitflow.Value {
+			return file.value
+		}
+	}
+	return res
+}
+
+func (col *FileCollector) MetricsMetadata() collector.MetricMetadataMap {
+	res := make(collector.MetricMetadataMap, len(col.files))
+	for _, file := range col.files {
+		res[col.String()+"/"+file.name] = collector.GaugeMetric("", "Value read from "+file.path)
+	}
+	return res
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"github.com/bitflow-stream/go-bitflow-collector"
+	log "github.com/sirupsen/logrus"
+)
+
+func main() {
+	log.Fatalln("This package is intended to be loaded as a plugin, not executed directly")
+}
+
+// The Symbol to be loaded
+var Plugin collector.CollectorPlugin = new(pluginImpl)
+
+type pluginImpl struct {
+}
+
+func (*pluginImpl) Name() string {
+	return "file-collector-plugin"
+}
+
+func (p *pluginImpl) Init(registry *collector.CollectorRegistry) error {
+	log.Debugf("Plugin %v: registering collector 'file'", p.Name())
+	RegisterFileCollector("file", registry)
+	return nil
+}
@@ -0,0 +1,211 @@
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bitflow-stream/go-bitflow/bitflow"
+)
+
+// latestSamples stores the most recently emitted samples together with the sampleGroups they were created from,
+// so that the values can be exported in other formats, see SampleSource.WritePrometheus().
+type latestSamples struct {
+	lock    sync.Mutex
+	groups  []*sampleGroup
+	samples []*bitflow.Sample
+}
+
+func (latest *latestSamples) set(groups []*sampleGroup, samples []*bitflow.Sample) {
+	latest.lock.Lock()
+	defer latest.lock.Unlock()
+	latest.groups = groups
+	latest.samples = make([]*bitflow.Sample, len(samples))
+	for i, sample := range samples {
+		// The sink might modify the values of the original sample
+		latest.samples[i] = &bitflow.Sample{
+			Time:   sample.Time,
+			Values: append([]bitflow.Value(nil), sample.Values...),
+		}
+	}
+}
+
+func (latest *latestSamples) get() ([]*sampleGroup, []*bitflow.Sample) {
+	latest.lock.Lock()
+	defer latest.lock.Unlock()
+	return latest.groups, latest.samples
+}
+
+type prometheusSeries struct {
+	labels string
+	value  bitflow.Value
+}
+
+type prometheusMetric struct {
+	meta   *MetricMetadata
+	series []prometheusSeries
+}
+
+// WritePrometheus writes the values of the most recently emitted samples in the Prometheus text exposition format.
+// The metric names are prefixed with the given prefix, and characters that are not allowed by Prometheus are replaced
+// with underscores. Metrics of a MetricEntity are labeled with the tags of the entity, and the entity-specific part is
+// removed from their names: for example, libvirt/vm1/net-io/bytes becomes libvirt_net_io_bytes{vm="vm1"}.
+// The metric type is derived from the MetricMetadata, where known. Nothing is written before the first sample is emitted.
+func (source *SampleSource) WritePrometheus(out io.Writer, prefix string) error {
+	groups, samples := source.latest.get()
+	metadata := source.CurrentMetadata()
+	metrics := make(map[string]*prometheusMetric)
+	for i, group := range groups {
+		byName := make(map[string]*Metric, len(group.metrics))
+		for _, metric := range group.metrics {
+			byName[metric.name] = metric
+		}
+		for j, field := range group.header.Fields {
+			fullName, name, tags := field, field, group.tags
+			if metric := byName[field]; metric != nil && metric.entity != nil {
+				entity := metric.entity
+				if len(group.tags) > 0 {
+					// Tagged sample, the prefix of the entity has already been removed from the field
+					fullName = entity.Prefix + field
+				}
+				if strings.HasPrefix(fullName, entity.Prefix) {
+					name = prometheusEntityName(entity) + fullName[len(entity.Prefix):]
+					tags = entity.Tags
+				}
+			}
+			name = prometheusName(prefix + name)
+			promMetric, ok := metrics[name]
+			if !ok {
+				promMetric = new(prometheusMetric)
+				if meta, ok := metadata[fullName]; ok {
+					promMetric.meta = &meta
+				}
+				metrics[name] = promMetric
+			}
+			promMetric.series = append(promMetric.series, prometheusSeries{
+				labels: prometheusLabels(tags),
+				value:  samples[i].Values[j],
+			})
+		}
+	}
+
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	writer := bufio.NewWriter(out)
+	for _, name := range names {
+		metric := metrics[name]
+		metricType := "untyped"
+		if meta := metric.meta; meta != nil {
+			if meta.Description != "" {
+				fmt.Fprintf(writer, "# HELP %v %v\n", name, prometheusEscape(meta.Description, false))
+			}
+			switch meta.Kind {
+			case Counter:
+				metricType = "counter"
+			case Gauge, Rate:
+				// Rates are computed by the collector and can decrease, unlike Prometheus counters
+				metricType = "gauge"
+			}
+		}
+		fmt.Fprintf(writer, "# TYPE %v %v\n", name, metricType)
+		for _, series := range metric.series {
+			fmt.Fprintf(writer, "%v%v %v\n", name, series.labels, prometheusValue(series.value))
+		}
+	}
+	return writer.Flush()
+}
+
+// prometheusEntityName returns the prefix of the entity without the parts that are contained in its tags,
+// for example libvirt/ for the entity with the prefix libvirt/vm1/ and the tag vm=vm1.
+// Every tag value is removed only once, starting from the end, so that a VM named "libvirt" results in libvirt/ as well.
+func prometheusEntityName(entity *MetricEntity) string {
+	values := make(map[string]int, len(entity.Tags))
+	for _, value := range entity.Tags {
+		values[value]++
+	}
+	parts := strings.Split(entity.Prefix, "/")
+	for i := len(parts) - 1; i >= 0; i-- {
+		if values[parts[i]] > 0 {
+			values[parts[i]]--
+			parts[i] = ""
+		}
+	}
+	var res strings.Builder
+	for _, part := range parts {
+		if part != "" {
+			res.WriteString(part)
+			res.WriteString("/")
+		}
+	}
+	return res.String()
+}
+
+// prometheusName replaces all characters that are not allowed in Prometheus metric names with underscores.
+// Names must not start with a digit, so an underscore is prepended in that case.
+func prometheusName(name string) string {
+	res := []byte(name)
+	for i, c := range res {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == ':') {
+			res[i] = '_'
+		}
+	}
+	if len(res) > 0 && res[0] >= '0' && res[0] <= '9' {
+		return "_" + string(res)
+	}
+	return string(res)
+}
+
+func prometheusLabels(tags map[string]string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var res strings.Builder
+	res.WriteString("{")
+	for i, key := range keys {
+		if i > 0 {
+			res.WriteString(",")
+		}
+		// Label names follow the same rules as metric names, except for colons
+		res.WriteString(strings.Replace(prometheusName(key), ":", "_", -1))
+		res.WriteString("=\"")
+		res.WriteString(prometheusEscape(tags[key], true))
+		res.WriteString("\"")
+	}
+	res.WriteString("}")
+	return res.String()
+}
+
+func prometheusEscape(str string, quotes bool) string {
+	str = strings.Replace(str, `\`, `\\`, -1)
+	str = strings.Replace(str, "\n", `\n`, -1)
+	if quotes {
+		str = strings.Replace(str, `"`, `\"`, -1)
+	}
+	return str
+}
+
+func prometheusValue(val bitflow.Value) string {
+	f := float64(val)
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
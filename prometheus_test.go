@@ -0,0 +1,80 @@
+package collector
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/antongulenko/golib"
+	"github.com/bitflow-stream/go-bitflow/bitflow"
+	"github.com/stretchr/testify/suite"
+)
+
+type PrometheusTestSuite struct {
+	golib.AbstractTestSuite
+}
+
+func TestPrometheus(t *testing.T) {
+	suite.Run(t, new(PrometheusTestSuite))
+}
+
+func (suite *PrometheusTestSuite) metrics() MetricSlice {
+	nginx := &MetricEntity{Prefix: "proc/nginx/", Tags: map[string]string{"proc": "nginx"}}
+	vm := &MetricEntity{Prefix: "libvirt/libvirt/", Tags: map[string]string{"vm": "libvirt"}}
+	metric := func(name string, entity *MetricEntity, value bitflow.Value) *Metric {
+		return &Metric{name: name, entity: entity, reader: func() bitflow.Value { return value }}
+	}
+	return MetricSlice{
+		metric("cpu", nil, 12.5),
+		metric("net-io/bytes", nil, bitflow.Value(math.Inf(1))),
+		metric("proc/nginx/cpu", nginx, 3),
+		metric("libvirt/libvirt/net-io/bytes", vm, bitflow.Value(math.NaN())),
+	}
+}
+
+func (suite *PrometheusTestSuite) write(tagged bool) string {
+	source := &SampleSource{TaggedSamples: tagged}
+	source.currentMetadata = MetricMetadataMap{
+		"cpu":            RateMetric("%", "CPU usage"),
+		"proc/nginx/cpu": CounterMetric("", "Line\nbreak"),
+		"net-io/bytes":   {Unit: UnitBytesPerSecond},
+	}
+	groups := source.createSampleGroups(suite.metrics())
+	samples := make([]*bitflow.Sample, len(groups))
+	for i, group := range groups {
+		samples[i] = group.makeSample(time.Unix(1000, 0))
+	}
+	source.latest.set(groups, samples)
+
+	var out bytes.Buffer
+	suite.NoError(source.WritePrometheus(&out, "bitflow_"))
+	return out.String()
+}
+
+func (suite *PrometheusTestSuite) TestWritePrometheus() {
+	expected := `# HELP bitflow_cpu CPU usage
+# TYPE bitflow_cpu gauge
+bitflow_cpu 12.5
+# TYPE bitflow_libvirt_net_io_bytes untyped
+bitflow_libvirt_net_io_bytes{vm="libvirt"} NaN
+# TYPE bitflow_net_io_bytes untyped
+bitflow_net_io_bytes +Inf
+# HELP bitflow_proc_cpu Line\nbreak
+# TYPE bitflow_proc_cpu counter
+bitflow_proc_cpu{proc="nginx"} 3
+`
+	suite.Equal(expected, suite.write(false))
+	suite.Equal(expected, suite.write(true), "tagged samples should result in the same metrics")
+}
+
+func (suite *PrometheusTestSuite) TestNoSample() {
+	var out bytes.Buffer
+	suite.NoError(new(SampleSource).WritePrometheus(&out, ""))
+	suite.Empty(out.String())
+}
+
+func (suite *PrometheusTestSuite) TestNames() {
+	suite.Equal("_1disk_io_sda_ioTime", prometheusName("1disk-io/sda/ioTime"))
+	suite.Equal(`{a_b="x\"y\\z",c="d"}`, prometheusLabels(map[string]string{"c": "d", "a:b": `x"y\z`}))
+}
@@ -37,6 +37,20 @@ func (col *CpuCollector) Metrics() collector.MetricReaderMap {
 	}
 }
 
+func (col *CpuCollector) MetricRings() collector.MetricRingMap {
+	return collector.MetricRingMap{
+		"cpu":         col.cpuTimes,
+		"cpu-jiffies": col.cpuJiffies,
+	}
+}
+
+func (col *CpuCollector) MetricsMetadata() collector.MetricMetadataMap {
+	return collector.MetricMetadataMap{
+		"cpu":         collector.RateMetric(collector.UnitPercent, "CPU utilization of the entire system"),
+		"cpu-jiffies": collector.RateMetric(collector.UnitSecondsPerSecond, "Busy CPU time of the entire system"),
+	}
+}
+
 func (col *CpuCollector) Update() (err error) {
 	times, err := cpu.Times(false)
 	if err == nil {
@@ -113,20 +113,24 @@ func (col *ioDiskCollector) Depends() []collector.Collector {
 }
 
 func (col *ioDiskCollector) Update() error {
+	// Check all disks first, so that the rings are not modified if the counters of one disk are missing
 	for _, diskName := range col.disks {
-		d, ok := col.parent.disks[diskName]
-		if !ok {
+		if _, ok := col.parent.disks[diskName]; !ok {
 			return fmt.Errorf("disk-io counters for disk %v not found", diskName)
 		}
+	}
+	for _, diskName := range col.disks {
+		d := col.parent.disks[diskName]
 		col.readRing.AddValueToHead(bitflow.Value(d.ReadCount))
 		col.writeRing.AddValueToHead(bitflow.Value(d.WriteCount))
 		col.ioRing.AddValueToHead(bitflow.Value(d.ReadCount + d.WriteCount))
 		col.readBytesRing.AddValueToHead(bitflow.Value(d.ReadBytes))
 		col.writeBytesRing.AddValueToHead(bitflow.Value(d.WriteBytes))
 		col.ioBytesRing.AddValueToHead(bitflow.Value(d.ReadBytes + d.WriteBytes))
-		col.readTimeRing.AddValueToHead(bitflow.Value(d.ReadTime))
-		col.writeTimeRing.AddValueToHead(bitflow.Value(d.WriteTime))
-		col.ioTimeRing.AddValueToHead(bitflow.Value(d.IoTime))
+		// The times in /proc/diskstats are 32 bit counters of milliseconds, which wrap around after ~50 days
+		col.readTimeRing.AddToHead(collector.Counter32(d.ReadTime))
+		col.writeTimeRing.AddToHead(collector.Counter32(d.WriteTime))
+		col.ioTimeRing.AddToHead(collector.Counter32(d.IoTime))
 	}
 	col.readRing.FlushHead()
 	col.writeRing.FlushHead()
@@ -140,6 +144,36 @@ func (col *ioDiskCollector) Update() error {
 	return nil
 }
 
+func (col *ioDiskCollector) MetricsMetadata() collector.MetricMetadataMap {
+	name := "disk-io/" + col.Name + "/"
+	return collector.MetricMetadataMap{
+		name + "read":       collector.RateMetric(collector.UnitPerSecond, "Read operations"),
+		name + "write":      collector.RateMetric(collector.UnitPerSecond, "Write operations"),
+		name + "io":         collector.RateMetric(collector.UnitPerSecond, "Read and write operations"),
+		name + "readBytes":  collector.RateMetric(collector.UnitBytesPerSecond, "Read throughput"),
+		name + "writeBytes": collector.RateMetric(collector.UnitBytesPerSecond, "Write throughput"),
+		name + "ioBytes":    collector.RateMetric(collector.UnitBytesPerSecond, "Read and write throughput"),
+		name + "readTime":   collector.RateMetric(collector.UnitMillisPerSecond, "Time spent reading"),
+		name + "writeTime":  collector.RateMetric(collector.UnitMillisPerSecond, "Time spent writing"),
+		name + "ioTime":     collector.RateMetric(collector.UnitMillisPerSecond, "Time spent doing IO"),
+	}
+}
+
+func (col *ioDiskCollector) MetricRings() collector.MetricRingMap {
+	name := "disk-io/" + col.Name + "/"
+	return collector.MetricRingMap{
+		name + "read":       col.readRing,
+		name + "write":      col.writeRing,
+		name + "io":         col.ioRing,
+		name + "readBytes":  col.readBytesRing,
+		name + "writeBytes": col.writeBytesRing,
+		name + "ioBytes":    col.ioBytesRing,
+		name + "readTime":   col.readTimeRing,
+		name + "writeTime":  col.writeTimeRing,
+		name + "ioTime":     col.ioTimeRing,
+	}
+}
+
 func (col *ioDiskCollector) Metrics() collector.MetricReaderMap {
 	name := "disk-io/" + col.Name + "/"
 	return collector.MetricReaderMap{
@@ -124,6 +124,17 @@ func (col *diskUsageCollector) Metrics() collector.MetricReaderMap {
 	}
 }
 
+func (col *diskUsageCollector) MetricsMetadata() collector.MetricMetadataMap {
+	return diskUsageMetadata(diskUsagePrefix + col.Name + "/")
+}
+
+func diskUsageMetadata(name string) collector.MetricMetadataMap {
+	return collector.MetricMetadataMap{
+		name + "free": collector.GaugeMetric(collector.UnitBytes, "Free disk space"),
+		name + "used": collector.GaugeMetric(collector.UnitPercent, "Percentage of used disk space"),
+	}
+}
+
 func (col *diskUsageCollector) readFree() bitflow.Value {
 	return bitflow.Value(col.stats.Free)
 }
@@ -154,6 +165,10 @@ func (col *allDiskUsageCollector) Metrics() collector.MetricReaderMap {
 	}
 }
 
+func (col *allDiskUsageCollector) MetricsMetadata() collector.MetricMetadataMap {
+	return diskUsageMetadata(diskUsagePrefix + diskUsageAll + "/")
+}
+
 func (col *allDiskUsageCollector) readFree() (res bitflow.Value) {
 	for _, part := range col.parent.partitions {
 		res += bitflow.Value(part.stats.Free)
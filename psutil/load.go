@@ -28,6 +28,14 @@ func (col *LoadCollector) Metrics() collector.MetricReaderMap {
 	}
 }
 
+func (col *LoadCollector) MetricsMetadata() collector.MetricMetadataMap {
+	return collector.MetricMetadataMap{
+		"load/1":  collector.GaugeMetric("", "System load average over 1 minute"),
+		"load/5":  collector.GaugeMetric("", "System load average over 5 minutes"),
+		"load/15": collector.GaugeMetric("", "System load average over 15 minutes"),
+	}
+}
+
 func (col *LoadCollector) Update() error {
 	loadAvg, err := load.Avg()
 
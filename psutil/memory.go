@@ -37,6 +37,14 @@ func (col *MemCollector) Metrics() collector.MetricReaderMap {
 	}
 }
 
+func (col *MemCollector) MetricsMetadata() collector.MetricMetadataMap {
+	return collector.MetricMetadataMap{
+		"mem/free":    collector.GaugeMetric(collector.UnitBytes, "Available memory"),
+		"mem/used":    collector.GaugeMetric(collector.UnitBytes, "Used memory"),
+		"mem/percent": collector.GaugeMetric(collector.UnitPercent, "Percentage of used memory"),
+	}
+}
+
 func (col *MemCollector) readFreeMem() bitflow.Value {
 	return bitflow.Value(col.memory.Available)
 }
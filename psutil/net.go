@@ -104,11 +104,20 @@ func (col *psutilNetInterfaceCollector) Update() error {
 }
 
 func (col *psutilNetInterfaceCollector) Metrics() collector.MetricReaderMap {
-	prefix := col.nicName
-	if prefix == "" {
-		prefix = "net-io"
-	} else {
-		prefix = "net-io/nic/" + prefix
+	return col.counters.Metrics(col.prefix())
+}
+
+func (col *psutilNetInterfaceCollector) MetricRings() collector.MetricRingMap {
+	return col.counters.Rings(col.prefix())
+}
+
+func (col *psutilNetInterfaceCollector) MetricsMetadata() collector.MetricMetadataMap {
+	return col.counters.Metadata(col.prefix())
+}
+
+func (col *psutilNetInterfaceCollector) prefix() string {
+	if col.nicName == "" {
+		return "net-io"
 	}
-	return col.counters.Metrics(prefix)
+	return "net-io/nic/" + col.nicName
 }
@@ -59,6 +59,28 @@ func (counters *BaseNetIoCounters) Metrics(prefix string) collector.MetricReader
 	}
 }
 
+func (counters *BaseNetIoCounters) Rings(prefix string) collector.MetricRingMap {
+	return collector.MetricRingMap{
+		prefix + "/bytes":      counters.Bytes,
+		prefix + "/packets":    counters.Packets,
+		prefix + "/rx_bytes":   counters.RxBytes,
+		prefix + "/rx_packets": counters.RxPackets,
+		prefix + "/tx_bytes":   counters.TxBytes,
+		prefix + "/tx_packets": counters.TxPackets,
+	}
+}
+
+func (counters *BaseNetIoCounters) Metadata(prefix string) collector.MetricMetadataMap {
+	return collector.MetricMetadataMap{
+		prefix + "/bytes":      collector.RateMetric(collector.UnitBytesPerSecond, "Received and sent bytes"),
+		prefix + "/packets":    collector.RateMetric(collector.UnitPacketsPerSecond, "Received and sent packets"),
+		prefix + "/rx_bytes":   collector.RateMetric(collector.UnitBytesPerSecond, "Received bytes"),
+		prefix + "/rx_packets": collector.RateMetric(collector.UnitPacketsPerSecond, "Received packets"),
+		prefix + "/tx_bytes":   collector.RateMetric(collector.UnitBytesPerSecond, "Sent bytes"),
+		prefix + "/tx_packets": collector.RateMetric(collector.UnitPacketsPerSecond, "Sent packets"),
+	}
+}
+
 type NetIoCounters struct {
 	BaseNetIoCounters
 	Errors  *collector.ValueRing
@@ -96,3 +118,17 @@ func (counters *NetIoCounters) Metrics(prefix string) collector.MetricReaderMap
 	m[prefix+"/dropped"] = counters.Dropped.GetDiff
 	return m
 }
+
+func (counters *NetIoCounters) Rings(prefix string) collector.MetricRingMap {
+	m := counters.BaseNetIoCounters.Rings(prefix)
+	m[prefix+"/errors"] = counters.Errors
+	m[prefix+"/dropped"] = counters.Dropped
+	return m
+}
+
+func (counters *NetIoCounters) Metadata(prefix string) collector.MetricMetadataMap {
+	m := counters.BaseNetIoCounters.Metadata(prefix)
+	m[prefix+"/errors"] = collector.RateMetric(collector.UnitPacketsPerSecond, "Receive and send errors")
+	m[prefix+"/dropped"] = collector.RateMetric(collector.UnitPacketsPerSecond, "Dropped incoming and outgoing packets")
+	return m
+}
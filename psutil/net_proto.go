@@ -71,6 +71,20 @@ func (col *NetProtoCollector) Metrics() collector.MetricReaderMap {
 	return res
 }
 
+func (col *NetProtoCollector) MetricsMetadata() collector.MetricMetadataMap {
+	res := make(collector.MetricMetadataMap)
+	for _, reader := range col.protoReaders {
+		name := "net-proto/" + reader.protocol + "/" + reader.field
+		description := "Protocol statistic " + reader.field + " of " + reader.protocol
+		if reader.ring != nil {
+			res[name] = collector.RateMetric(collector.UnitPerSecond, description)
+		} else {
+			res[name] = collector.GaugeMetric("", description)
+		}
+	}
+	return res
+}
+
 func (col *NetProtoCollector) update(checkChange bool) error {
 	counters, err := psnet.ProtoCounters(nil)
 	if err != nil {
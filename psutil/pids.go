@@ -26,6 +26,12 @@ func (col *PidCollector) Metrics() collector.MetricReaderMap {
 	}
 }
 
+func (col *PidCollector) MetricsMetadata() collector.MetricMetadataMap {
+	return collector.MetricMetadataMap{
+		"num_procs": collector.GaugeMetric(collector.UnitCount, "Number of processes in the system"),
+	}
+}
+
 func (col *PidCollector) Update() (err error) {
 	if col.pids, err = process.Pids(); err != nil {
 		err = fmt.Errorf("Failed to update PIDs: %v", err)
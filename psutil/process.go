@@ -13,6 +13,9 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// ProcessGroupTag is the tag key identifying the process group in tagged samples
+const ProcessGroupTag = "proc"
+
 var (
 	PidUpdateInterval = 60 * time.Second
 
@@ -28,6 +31,7 @@ type ProcessCollector struct {
 	printErrors     bool
 	includeChildren bool
 	pids            *PidCollector
+	entity          *collector.MetricEntity
 
 	pidsUpdated bool
 	procs       map[int32]*processInfo
@@ -35,7 +39,7 @@ type ProcessCollector struct {
 }
 
 func (col *RootCollector) NewProcessCollector(filter []*regexp.Regexp, name string, printErrors bool, includeChildProcesses bool) *ProcessCollector {
-	return &ProcessCollector{
+	procCol := &ProcessCollector{
 		AbstractCollector: col.Child(name),
 		cmdlineFilter:     filter,
 		groupName:         name,
@@ -44,6 +48,11 @@ func (col *RootCollector) NewProcessCollector(filter []*regexp.Regexp, name stri
 		factory:           col.Factory,
 		pids:              col.pids,
 	}
+	procCol.entity = &collector.MetricEntity{
+		Prefix: procCol.prefix() + "/",
+		Tags:   map[string]string{ProcessGroupTag: name},
+	}
+	return procCol
 }
 
 func (col *RootCollector) NewMultiProcessCollector(name string) *MultiProcessCollector {
@@ -115,10 +124,20 @@ func (col *ProcessCollector) Metrics() collector.MetricReaderMap {
 	}
 }
 
+func (col *ProcessCollector) MetricsMetadata() collector.MetricMetadataMap {
+	return collector.MetricMetadataMap{
+		col.prefix() + "/num": collector.GaugeMetric(collector.UnitCount, "Number of processes in the group"),
+	}
+}
+
 func (col *ProcessCollector) Depends() []collector.Collector {
 	return []collector.Collector{col.pids}
 }
 
+func (col *ProcessCollector) Entity() *collector.MetricEntity {
+	return col.entity
+}
+
 func (col *ProcessCollector) Update() error {
 	return col.updatePids()
 }
@@ -177,7 +196,7 @@ func (col *ProcessCollector) updatePids() error {
 
 	if PidUpdateInterval > 0 {
 		col.pidsUpdated = true
-		time.AfterFunc(PidUpdateInterval, func() {
+		col.factory.GetClock().AfterFunc(PidUpdateInterval, func() {
 			col.pidsUpdated = false
 		})
 	} else {
@@ -271,6 +290,7 @@ type processSubCollector struct {
 
 type processSubCollectorImpl interface {
 	metrics(parent *ProcessCollector) collector.MetricReaderMap
+	metadata(parent *ProcessCollector) collector.MetricMetadataMap
 	updateProc(info *processInfo) error
 }
 
@@ -286,10 +306,18 @@ func (col *processSubCollector) Metrics() collector.MetricReaderMap {
 	return col.impl.metrics(col.parent)
 }
 
+func (col *processSubCollector) MetricsMetadata() collector.MetricMetadataMap {
+	return col.impl.metadata(col.parent)
+}
+
 func (col *processSubCollector) Depends() []collector.Collector {
 	return []collector.Collector{col.parent}
 }
 
+func (col *processSubCollector) Entity() *collector.MetricEntity {
+	return col.parent.entity
+}
+
 func (col *processSubCollector) Update() error {
 	deletedProcesses := col.doUpdate()
 	if len(deletedProcesses) > 0 {
@@ -28,6 +28,13 @@ func (col *processCpuCollector) metrics(parent *ProcessCollector) collector.Metr
 	}
 }
 
+func (col *processCpuCollector) metadata(parent *ProcessCollector) collector.MetricMetadataMap {
+	return collector.MetricMetadataMap{
+		parent.prefix() + "/cpu":         collector.RateMetric(collector.UnitPercent, "CPU utilization of the process group, relative to all CPU cores"),
+		parent.prefix() + "/cpu-jiffies": collector.RateMetric(collector.UnitSecondsPerSecond, "Busy CPU time of the process group"),
+	}
+}
+
 func (col *processCpuCollector) updateProc(info *processInfo) error {
 	if cpu, err := info.Times(); err != nil {
 		return fmt.Errorf("Failed to get CPU info: %v", err)
@@ -72,6 +79,18 @@ func (col *processDiskCollector) metrics(parent *ProcessCollector) collector.Met
 	}
 }
 
+func (col *processDiskCollector) metadata(parent *ProcessCollector) collector.MetricMetadataMap {
+	prefix := parent.prefix()
+	return collector.MetricMetadataMap{
+		prefix + "/disk/read":       collector.RateMetric(collector.UnitPerSecond, "Read operations of the process group"),
+		prefix + "/disk/write":      collector.RateMetric(collector.UnitPerSecond, "Write operations of the process group"),
+		prefix + "/disk/io":         collector.RateMetric(collector.UnitPerSecond, "Read and write operations of the process group"),
+		prefix + "/disk/readBytes":  collector.RateMetric(collector.UnitBytesPerSecond, "Read throughput of the process group"),
+		prefix + "/disk/writeBytes": collector.RateMetric(collector.UnitBytesPerSecond, "Write throughput of the process group"),
+		prefix + "/disk/ioBytes":    collector.RateMetric(collector.UnitBytesPerSecond, "Read and write throughput of the process group"),
+	}
+}
+
 func (col *processDiskCollector) updateProc(info *processInfo) error {
 	if io, err := info.IOCounters(); err != nil {
 		return fmt.Errorf("Failed to get disk-IO info: %v", err)
@@ -107,6 +126,15 @@ func (col *processMemoryCollector) metrics(parent *ProcessCollector) collector.M
 	}
 }
 
+func (col *processMemoryCollector) metadata(parent *ProcessCollector) collector.MetricMetadataMap {
+	prefix := parent.prefix()
+	return collector.MetricMetadataMap{
+		prefix + "/mem/rss":  collector.GaugeMetric(collector.UnitBytes, "Resident memory of the process group"),
+		prefix + "/mem/vms":  collector.GaugeMetric(collector.UnitBytes, "Virtual memory of the process group"),
+		prefix + "/mem/swap": collector.GaugeMetric(collector.UnitBytes, "Swapped memory of the process group"),
+	}
+}
+
 func (col *processMemoryCollector) updateProc(info *processInfo) error {
 	// Alternative: col.MemoryInfoEx()
 	if mem, err := info.MemoryInfo(); err != nil {
@@ -160,6 +188,11 @@ func (col *processNetCollector) metrics(parent *ProcessCollector) collector.Metr
 	}
 }
 
+func (col *processNetCollector) metadata(parent *ProcessCollector) collector.MetricMetadataMap {
+	var counters NetIoCounters
+	return counters.Metadata(parent.prefix() + "/net-io")
+}
+
 func (col *processNetCollector) updateProc(info *processInfo) error {
 	// Alternative: col.Connections()
 	if counters, err := info.NetIOCounters(false); err != nil {
@@ -185,6 +218,12 @@ func (col *processFdCollector) metrics(parent *ProcessCollector) collector.Metri
 	}
 }
 
+func (col *processFdCollector) metadata(parent *ProcessCollector) collector.MetricMetadataMap {
+	return collector.MetricMetadataMap{
+		parent.prefix() + "/fds": collector.GaugeMetric(collector.UnitCount, "Open file descriptors of the process group"),
+	}
+}
+
 func (col *processFdCollector) updateProc(info *processInfo) error {
 	// Alternative: col.NumFDs(), proc.OpenFiles()
 	if num, err := col.procNumFds(info); err != nil {
@@ -237,6 +276,16 @@ func (col *processMiscCollector) metrics(parent *ProcessCollector) collector.Met
 	}
 }
 
+func (col *processMiscCollector) metadata(parent *ProcessCollector) collector.MetricMetadataMap {
+	prefix := parent.prefix()
+	return collector.MetricMetadataMap{
+		prefix + "/threads":               collector.GaugeMetric(collector.UnitCount, "Threads of the process group"),
+		prefix + "/ctxSwitch":             collector.RateMetric(collector.UnitPerSecond, "Context switches of the process group"),
+		prefix + "/ctxSwitch/voluntary":   collector.RateMetric(collector.UnitPerSecond, "Voluntary context switches of the process group"),
+		prefix + "/ctxSwitch/involuntary": collector.RateMetric(collector.UnitPerSecond, "Involuntary context switches of the process group"),
+	}
+}
+
 func (col *processMiscCollector) updateProc(info *processInfo) error {
 	// Misc, Alternative: col.NumThreads(), col.NumCtxSwitches()
 	if numThreads, ctxSwitches, err := col.procGetMisc(info); err != nil {
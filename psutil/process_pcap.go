@@ -105,6 +105,11 @@ func (col *processPcapCollector) metrics(parent *ProcessCollector) collector.Met
 	}
 }
 
+func (col *processPcapCollector) metadata(parent *ProcessCollector) collector.MetricMetadataMap {
+	var counters BaseNetIoCounters
+	return counters.Metadata(parent.prefix() + "/net-pcap")
+}
+
 func (col *processPcapCollector) updateProc(info *processInfo) error {
 	cons, err := pcapCons.FilterConnections([]int{int(info.Pid)})
 	if err != nil {
@@ -0,0 +1,49 @@
+package psutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/antongulenko/golib"
+	"github.com/bitflow-stream/go-bitflow-collector/collectortest"
+	"github.com/bitflow-stream/go-bitflow/bitflow"
+	"github.com/shirou/gopsutil/cpu"
+	"github.com/stretchr/testify/suite"
+)
+
+type PsutilTestSuite struct {
+	golib.AbstractTestSuite
+	harness *collectortest.Harness
+}
+
+func TestPsutilCollector(t *testing.T) {
+	suite.Run(t, new(PsutilTestSuite))
+}
+
+func (s *PsutilTestSuite) SetupTest() {
+	s.harness = collectortest.New(s.T())
+}
+
+func (s *PsutilTestSuite) TestHostMetrics() {
+	s.harness.Init(NewPsutilRootCollector(s.harness.Factory))
+	s.harness.Run(3)
+
+	// The values depend on the host, only check that the basic metrics are collected and described
+	s.harness.AssertMetrics("cpu", "cpu-jiffies", "mem/free", "mem/used", "mem/percent", "load/1", "load/5", "load/15")
+	s.harness.AssertMetadata()
+	cpuValue := s.harness.Snapshot()["cpu"]
+	s.True(cpuValue >= 0 && cpuValue <= 100, "CPU utilization out of range")
+}
+
+func (s *PsutilTestSuite) TestCpuTimeDiff() {
+	older := &cpuTime{cpu.TimesStat{User: 10, System: 10, Idle: 80}}
+	newer := &cpuTime{cpu.TimesStat{User: 30, System: 20, Idle: 150}}
+	// 30 of 100 jiffies were busy
+	s.Equal(bitflow.Value(30), newer.DiffValue(older, time.Second))
+
+	idle := &cpuTime{cpu.TimesStat{User: 30, System: 20, Idle: 250}}
+	s.Equal(bitflow.Value(0), idle.DiffValue(newer, time.Second))
+
+	sum := older.AddValue(newer).(*cpuTime)
+	s.Equal(cpu.TimesStat{User: 40, System: 30, Idle: 230}, sum.TimesStat)
+}
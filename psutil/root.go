@@ -2,6 +2,25 @@ package psutil
 
 import "github.com/bitflow-stream/go-bitflow-collector"
 
+// ProcessesCollectorName is the name of the MultiProcessCollector created by the registered "psutil" collector factory
+const ProcessesCollectorName = "processes"
+
+func init() {
+	collector.RegisterCollector(&collector.CollectorFactory{
+		Name:        "psutil",
+		Description: "Metrics of the local host and of monitored process groups, mostly read from the /proc filesystem",
+		Parameters: []collector.FactoryParameter{
+			{Name: "pcap_nics", Type: collector.ListParameter,
+				Description: "NICs to capture packets from for PCAP-based monitoring of process network IO"},
+		},
+		New: func(params collector.CollectorParameters, factory *collector.ValueRingFactory) ([]collector.Collector, error) {
+			PcapNics = params.List("pcap_nics")
+			root := NewPsutilRootCollector(factory)
+			return []collector.Collector{root, root.NewMultiProcessCollector(ProcessesCollectorName)}, nil
+		},
+	})
+}
+
 type RootCollector struct {
 	collector.AbstractCollector
 
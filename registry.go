@@ -0,0 +1,195 @@
+package collector
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type ParameterType string
+
+const (
+	StringParameter   = ParameterType("string")
+	BoolParameter     = ParameterType("bool")
+	IntParameter      = ParameterType("int")
+	DurationParameter = ParameterType("duration")
+	ListParameter     = ParameterType("list") // Comma-separated list of strings
+)
+
+// FactoryParameter describes one parameter accepted by a CollectorFactory. Parameter values are passed as strings,
+// and parsed according to Type. Parameters that are not given explicitly receive the Default value,
+// except for Required parameters, which must always be given.
+type FactoryParameter struct {
+	Name        string
+	Type        ParameterType
+	Default     string
+	Description string
+	Required    bool
+}
+
+func (param *FactoryParameter) parse(value string) (interface{}, error) {
+	switch param.Type {
+	case StringParameter:
+		return value, nil
+	case BoolParameter:
+		return strconv.ParseBool(value)
+	case IntParameter:
+		return strconv.Atoi(value)
+	case DurationParameter:
+		return time.ParseDuration(value)
+	case ListParameter:
+		var res []string
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				res = append(res, part)
+			}
+		}
+		return res, nil
+	default:
+		return nil, fmt.Errorf("Unknown parameter type: %v", param.Type)
+	}
+}
+
+// CollectorParameters contains the parsed parameter values passed to CollectorFactory.New.
+// The accessor methods panic when the parameter has not been declared with the according type.
+type CollectorParameters map[string]interface{}
+
+func (params CollectorParameters) String(name string) string {
+	return params[name].(string)
+}
+
+func (params CollectorParameters) Bool(name string) bool {
+	return params[name].(bool)
+}
+
+func (params CollectorParameters) Int(name string) int {
+	return params[name].(int)
+}
+
+func (params CollectorParameters) Duration(name string) time.Duration {
+	return params[name].(time.Duration)
+}
+
+func (params CollectorParameters) List(name string) []string {
+	return params[name].([]string)
+}
+
+// CollectorFactory creates one or more root collectors that belong together, like the psutil root collector
+// and the collector for process groups.
+type CollectorFactory struct {
+	Name        string
+	Description string
+	Parameters  []FactoryParameter
+	New         func(params CollectorParameters, factory *ValueRingFactory) ([]Collector, error)
+
+	// DisabledByDefault factories are only used when they are enabled explicitly. This is set for all factories
+	// registered by plugins, see LoadPlugin().
+	DisabledByDefault bool
+}
+
+// ParseParameters validates the given parameter values and fills in default values for missing parameters.
+func (f *CollectorFactory) ParseParameters(values map[string]string) (CollectorParameters, error) {
+	for name := range values {
+		if f.parameter(name) == nil {
+			return nil, fmt.Errorf("Unknown parameter '%v' for collector '%v'", name, f.Name)
+		}
+	}
+	res := make(CollectorParameters, len(f.Parameters))
+	for i := range f.Parameters {
+		param := &f.Parameters[i]
+		value, ok := values[param.Name]
+		if !ok {
+			if param.Required {
+				return nil, fmt.Errorf("Missing required parameter '%v' for collector '%v'", param.Name, f.Name)
+			}
+			value = param.Default
+		}
+		parsed, err := param.parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid value '%v' for parameter '%v' of collector '%v': %v", value, param.Name, f.Name, err)
+		}
+		res[param.Name] = parsed
+	}
+	return res, nil
+}
+
+// Create parses the given parameter values and creates the root collectors
+func (f *CollectorFactory) Create(values map[string]string, factory *ValueRingFactory) ([]Collector, error) {
+	params, err := f.ParseParameters(values)
+	if err != nil {
+		return nil, err
+	}
+	return f.New(params, factory)
+}
+
+func (f *CollectorFactory) parameter(name string) *FactoryParameter {
+	for i, param := range f.Parameters {
+		if param.Name == name {
+			return &f.Parameters[i]
+		}
+	}
+	return nil
+}
+
+// CollectorRegistry contains named collector factories, so that collectors can be enabled and configured by name.
+type CollectorRegistry struct {
+	factories map[string]*CollectorFactory
+	lock      sync.Mutex
+}
+
+func NewCollectorRegistry() *CollectorRegistry {
+	return &CollectorRegistry{
+		factories: make(map[string]*CollectorFactory),
+	}
+}
+
+// Registry is the default registry. The collector packages register their factories here in their init() functions.
+var Registry = NewCollectorRegistry()
+
+// RegisterCollector adds the given factory to the default Registry.
+func RegisterCollector(factory *CollectorFactory) {
+	Registry.Register(factory)
+}
+
+// Register adds a named factory. It panics if the name is empty or already registered.
+func (r *CollectorRegistry) Register(factory *CollectorFactory) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if factory.Name == "" || factory.New == nil {
+		panic("CollectorFactory must have a Name and a New function")
+	}
+	if _, ok := r.factories[factory.Name]; ok {
+		panic(fmt.Sprintf("Collector factory '%v' registered twice", factory.Name))
+	}
+	r.factories[factory.Name] = factory
+}
+
+func (r *CollectorRegistry) remove(name string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.factories, name)
+}
+
+// Get returns the factory with the given name, or nil
+func (r *CollectorRegistry) Get(name string) *CollectorFactory {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.factories[name]
+}
+
+// Factories returns all registered factories, sorted by name
+func (r *CollectorRegistry) Factories() []*CollectorFactory {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	res := make([]*CollectorFactory, 0, len(r.factories))
+	for _, factory := range r.factories {
+		res = append(res, factory)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
@@ -0,0 +1,109 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/antongulenko/golib"
+	"github.com/stretchr/testify/suite"
+)
+
+type RegistryTestSuite struct {
+	golib.AbstractTestSuite
+}
+
+func TestRegistry(t *testing.T) {
+	suite.Run(t, new(RegistryTestSuite))
+}
+
+func (suite *RegistryTestSuite) newFactory(name string, params ...FactoryParameter) *CollectorFactory {
+	return &CollectorFactory{
+		Name:       name,
+		Parameters: params,
+		New: func(params CollectorParameters, factory *ValueRingFactory) ([]Collector, error) {
+			return []Collector{&testCollector{AbstractCollector: RootCollector(name)}}, nil
+		},
+	}
+}
+
+func (suite *RegistryTestSuite) TestParse() {
+	parse := func(paramType ParameterType, value string) interface{} {
+		param := FactoryParameter{Name: "p", Type: paramType}
+		res, err := param.parse(value)
+		suite.NoError(err)
+		return res
+	}
+	suite.Equal("x", parse(StringParameter, "x"))
+	suite.Equal(true, parse(BoolParameter, "true"))
+	suite.Equal(-5, parse(IntParameter, "-5"))
+	suite.Equal(1500*time.Millisecond, parse(DurationParameter, "1.5s"))
+	suite.Equal([]string{"a", "b"}, parse(ListParameter, " a, ,b,"))
+	suite.Nil(parse(ListParameter, ""))
+
+	for _, param := range []FactoryParameter{
+		{Type: BoolParameter},
+		{Type: IntParameter},
+		{Type: DurationParameter},
+		{Type: ParameterType("unknown")},
+	} {
+		_, err := param.parse("invalid")
+		suite.Error(err, param.Type)
+	}
+}
+
+func (suite *RegistryTestSuite) TestParseParameters() {
+	factory := suite.newFactory("test",
+		FactoryParameter{Name: "uri", Type: StringParameter, Default: "local"},
+		FactoryParameter{Name: "interval", Type: DurationParameter, Default: "1s"},
+		FactoryParameter{Name: "host", Type: StringParameter, Required: true})
+
+	params, err := factory.ParseParameters(map[string]string{"host": "h1", "interval": "2s"})
+	suite.NoError(err)
+	suite.Equal("local", params.String("uri"), "default value")
+	suite.Equal(2*time.Second, params.Duration("interval"))
+	suite.Equal("h1", params.String("host"))
+
+	_, err = factory.ParseParameters(map[string]string{"host": "h1", "other": "x"})
+	suite.EqualError(err, "Unknown parameter 'other' for collector 'test'")
+	_, err = factory.ParseParameters(map[string]string{"uri": "remote"})
+	suite.EqualError(err, "Missing required parameter 'host' for collector 'test'")
+	_, err = factory.ParseParameters(map[string]string{"host": "h1", "interval": "soon"})
+	suite.Error(err)
+
+	// Invalid default values are reported as well
+	factory = suite.newFactory("test", FactoryParameter{Name: "workers", Type: IntParameter, Default: "many"})
+	_, err = factory.ParseParameters(nil)
+	suite.Error(err)
+}
+
+func (suite *RegistryTestSuite) TestCreate() {
+	factory := suite.newFactory("test", FactoryParameter{Name: "host", Type: StringParameter, Required: true})
+	cols, err := factory.Create(map[string]string{"host": "h1"}, nil)
+	suite.NoError(err)
+	suite.Len(cols, 1)
+	_, err = factory.Create(nil, nil)
+	suite.Error(err)
+}
+
+func (suite *RegistryTestSuite) TestRegister() {
+	registry := NewCollectorRegistry()
+	registry.Register(suite.newFactory("b"))
+	registry.Register(suite.newFactory("a"))
+	suite.Nil(registry.Get("c"))
+	suite.Equal("a", registry.Get("a").Name)
+	factories := registry.Factories()
+	suite.Len(factories, 2)
+	suite.Equal("a", factories[0].Name)
+	suite.Equal("b", factories[1].Name)
+
+	suite.Panics(func() {
+		registry.Register(suite.newFactory("a"))
+	}, "duplicate name")
+	suite.Panics(func() {
+		registry.Register(suite.newFactory(""))
+	}, "empty name")
+	suite.Panics(func() {
+		registry.Register(&CollectorFactory{Name: "c"})
+	}, "missing New function")
+	suite.Nil(registry.Get("c"))
+}
@@ -0,0 +1,151 @@
+package collector
+
+import (
+	"encoding/json"
+	"math/rand"
+	"regexp"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RetryPolicy configures how update failures of a collector are tolerated, and how often a failed collector
+// is checked for recovery. After a collector has failed, the delay between two recovery attempts starts at BackoffBase
+// and is doubled after every unsuccessful attempt, up to BackoffMax. Jitter randomly varies every delay by the given
+// fraction (e.g. 0.1 for +-10%) to avoid synchronized retries of many collectors. Jitter is limited to [0, 1].
+// In JSON, BackoffBase and BackoffMax are represented as duration strings like "10s".
+type RetryPolicy struct {
+	ToleratedFailures int
+	BackoffBase       time.Duration
+	BackoffMax        time.Duration
+	Jitter            float64
+}
+
+// withDefaults fills unset fields: ToleratedUpdateFailures is tolerated, and recovery is checked every checkInterval.
+func (p RetryPolicy) withDefaults(checkInterval time.Duration) RetryPolicy {
+	if p.ToleratedFailures <= 0 {
+		p.ToleratedFailures = ToleratedUpdateFailures
+	}
+	if p.BackoffBase <= 0 {
+		p.BackoffBase = checkInterval
+	}
+	if p.BackoffMax < p.BackoffBase {
+		p.BackoffMax = p.BackoffBase
+	}
+	if p.Jitter < 0 {
+		p.Jitter = 0
+	} else if p.Jitter > 1 {
+		// Larger values could result in negative delays
+		p.Jitter = 1
+	}
+	return p
+}
+
+type jsonRetryPolicy struct {
+	ToleratedFailures int     `json:"tolerated_failures"`
+	BackoffBase       string  `json:"backoff_base"`
+	BackoffMax        string  `json:"backoff_max"`
+	Jitter            float64 `json:"jitter"`
+}
+
+func (p RetryPolicy) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonRetryPolicy{
+		ToleratedFailures: p.ToleratedFailures,
+		BackoffBase:       p.BackoffBase.String(),
+		BackoffMax:        p.BackoffMax.String(),
+		Jitter:            p.Jitter,
+	})
+}
+
+func (p *RetryPolicy) UnmarshalJSON(data []byte) error {
+	var parsed jsonRetryPolicy
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return err
+	}
+	res := RetryPolicy{ToleratedFailures: parsed.ToleratedFailures, Jitter: parsed.Jitter}
+	for _, field := range []struct {
+		str    string
+		target *time.Duration
+	}{{parsed.BackoffBase, &res.BackoffBase}, {parsed.BackoffMax, &res.BackoffMax}} {
+		if field.str == "" {
+			continue
+		}
+		dur, err := time.ParseDuration(field.str)
+		if err != nil {
+			return err
+		}
+		*field.target = dur
+	}
+	*p = res
+	return nil
+}
+
+// Delay returns the delay before the next recovery attempt, after the given number of unsuccessful attempts.
+func (p RetryPolicy) Delay(attempts int) time.Duration {
+	delay := p.BackoffBase
+	for i := 0; i < attempts && delay < p.BackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > p.BackoffMax {
+		delay = p.BackoffMax
+	}
+	if p.Jitter > 0 {
+		delay = time.Duration(float64(delay) * (1 + p.Jitter*(2*rand.Float64()-1)))
+	}
+	return delay
+}
+
+// RetryState describes the recovery attempts of a failed collector
+type RetryState struct {
+	Attempts  int       `json:"attempts"`
+	NextRetry time.Time `json:"next_retry"`
+}
+
+func (g *collectorGraph) applyRetryPolicies(defaultPolicy RetryPolicy, policies map[*regexp.Regexp]RetryPolicy, checkInterval time.Duration) {
+	defaultPolicy = defaultPolicy.withDefaults(checkInterval)
+	for _, node := range g.collectors {
+		node.setRetryPolicy(defaultPolicy)
+	}
+	for regex, policy := range policies {
+		policy = policy.withDefaults(checkInterval)
+		count := 0
+		for _, node := range g.collectors {
+			if regex.MatchString(node.String()) {
+				node.setRetryPolicy(policy)
+				count++
+			}
+		}
+		log.Debugf("Retry policy %+v applied to %v nodes matching %v", policy, count, regex.String())
+	}
+}
+
+func (node *collectorNode) setRetryPolicy(policy RetryPolicy) {
+	node.statsLock.Lock()
+	defer node.statsLock.Unlock()
+	node.retryPolicy = policy
+}
+
+// retryDue returns true if the recovery of the failed node should be checked now. The first recovery attempt
+// is scheduled when this is called for the first time after the node failed.
+func (node *collectorNode) retryDue(now time.Time) bool {
+	node.statsLock.Lock()
+	defer node.statsLock.Unlock()
+	if node.retry.NextRetry.IsZero() {
+		node.retry.NextRetry = now.Add(node.retryPolicy.Delay(0))
+		return false
+	}
+	return !now.Before(node.retry.NextRetry)
+}
+
+func (node *collectorNode) retryFailed(now time.Time) {
+	node.statsLock.Lock()
+	defer node.statsLock.Unlock()
+	node.retry.Attempts++
+	node.retry.NextRetry = now.Add(node.retryPolicy.Delay(node.retry.Attempts))
+}
+
+func (node *collectorNode) resetRetry() {
+	node.statsLock.Lock()
+	defer node.statsLock.Unlock()
+	node.retry = RetryState{}
+}
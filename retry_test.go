@@ -0,0 +1,53 @@
+package collector
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/antongulenko/golib"
+	"github.com/stretchr/testify/suite"
+)
+
+type RetryTestSuite struct {
+	golib.AbstractTestSuite
+}
+
+func TestRetry(t *testing.T) {
+	suite.Run(t, new(RetryTestSuite))
+}
+
+func (suite *RetryTestSuite) TestDefaults() {
+	policy := RetryPolicy{BackoffMax: time.Second, Jitter: -1}.withDefaults(5 * time.Second)
+	suite.Equal(RetryPolicy{ToleratedFailures: ToleratedUpdateFailures, BackoffBase: 5 * time.Second, BackoffMax: 5 * time.Second}, policy)
+	suite.Equal(1.0, RetryPolicy{Jitter: 3}.withDefaults(time.Second).Jitter)
+}
+
+func (suite *RetryTestSuite) TestDelay() {
+	policy := RetryPolicy{BackoffBase: time.Second, BackoffMax: 5 * time.Second}
+	suite.Equal(time.Second, policy.Delay(0))
+	suite.Equal(4*time.Second, policy.Delay(2))
+	suite.Equal(5*time.Second, policy.Delay(10))
+
+	// The delay is never negative, even with the maximum jitter
+	policy = RetryPolicy{Jitter: 5}.withDefaults(time.Second)
+	for i := 0; i < 100; i++ {
+		delay := policy.Delay(0)
+		suite.True(delay >= 0 && delay <= 2*time.Second, delay)
+	}
+}
+
+func (suite *RetryTestSuite) TestJSON() {
+	policy := RetryPolicy{ToleratedFailures: 5, BackoffBase: 10 * time.Second, BackoffMax: 5 * time.Minute, Jitter: 0.1}
+	data, err := json.Marshal(policy)
+	suite.NoError(err)
+	suite.Equal(`{"tolerated_failures":5,"backoff_base":"10s","backoff_max":"5m0s","jitter":0.1}`, string(data))
+
+	var parsed RetryPolicy
+	suite.NoError(json.Unmarshal(data, &parsed))
+	suite.Equal(policy, parsed)
+	suite.NoError(json.Unmarshal([]byte(`{"tolerated_failures":3}`), &parsed))
+	suite.Equal(RetryPolicy{ToleratedFailures: 3}, parsed)
+	suite.Error(json.Unmarshal([]byte(`{"backoff_base":10000000000}`), &parsed))
+	suite.Error(json.Unmarshal([]byte(`{"backoff_max":"soon"}`), &parsed))
+}
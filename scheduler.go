@@ -0,0 +1,192 @@
+package collector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/antongulenko/golib"
+	"github.com/bitflow-stream/go-bitflow/bitflow"
+	log "github.com/sirupsen/logrus"
+)
+
+// SchedulerStatistics describes the update rounds performed by a bounded pool of workers, see SampleSource.UpdateWorkers.
+// The lag is the time a collector waited for a free worker after all its dependencies have been updated.
+type SchedulerStatistics struct {
+	Workers         int       `json:"workers"`
+	Collectors      int       `json:"collectors"`
+	Rounds          uint64    `json:"rounds"`
+	LastRound       time.Time `json:"last_round"`
+	LastRoundMillis float64   `json:"last_round_ms"`
+	LastLagMillis   float64   `json:"last_lag_ms"`
+	MaxLagMillis    float64   `json:"max_lag_ms"`
+}
+
+// updateScheduler updates the nodes of a graph in rounds, using a fixed number of worker goroutines instead of
+// one goroutine per node. Nodes are handed to the workers in topological order: a node is only updated
+// after all its dependencies have been updated in the same round.
+type updateScheduler struct {
+	graph   *collectorGraph
+	workers int
+
+	// Fixed after newUpdateScheduler(). Deleted and failed nodes stay in place and are skipped by the workers.
+	order        []*collectorNode
+	dependencies map[*collectorNode]int
+	dependents   map[*collectorNode][]*collectorNode
+	lastUpdates  map[*collectorNode]*time.Time
+
+	jobs    chan scheduledUpdate
+	results chan scheduledUpdate
+
+	// Optional, called after every complete round while no collector is updated
+	roundFinished func(end time.Time)
+
+	statsLock         sync.Mutex
+	rounds            uint64
+	lastRound         time.Time
+	lastRoundDuration time.Duration
+	lastLag           time.Duration
+	maxLag            time.Duration
+}
+
+type scheduledUpdate struct {
+	node  *collectorNode
+	ready time.Time
+	lag   time.Duration
+}
+
+func newUpdateScheduler(graph *collectorGraph, workers int) *updateScheduler {
+	s := &updateScheduler{
+		graph:        graph,
+		workers:      workers,
+		order:        sortGraph(graph),
+		dependencies: make(map[*collectorNode]int),
+		dependents:   make(map[*collectorNode][]*collectorNode),
+		lastUpdates:  make(map[*collectorNode]*time.Time),
+	}
+	for _, node := range s.order {
+		s.lastUpdates[node] = new(time.Time)
+		for _, dependsCol := range node.collector.Depends() {
+			depends := graph.resolve(dependsCol)
+			s.dependencies[node]++
+			s.dependents[depends] = append(s.dependents[depends], node)
+		}
+	}
+	if s.workers > len(s.order) {
+		s.workers = len(s.order)
+	}
+	// The buffers can hold all nodes, so that scheduling a node never blocks
+	s.jobs = make(chan scheduledUpdate, len(s.order))
+	s.results = make(chan scheduledUpdate, len(s.order))
+	return s
+}
+
+// start performs the first update round synchronously and then starts updating in the given interval,
+// until the stopper is stopped.
+func (s *updateScheduler) start(wg *sync.WaitGroup, stopper golib.StopChan, interval time.Duration) {
+	for i := 0; i < s.workers; i++ {
+		wg.Add(1)
+		go s.work(wg, stopper)
+	}
+	log.Debugln("Performing initial collector updates with", s.workers, "workers...")
+	clock := s.graph.clock
+	triggerTime := clock.Now()
+	s.round(triggerTime)
+	log.Debugln("Initial updates complete, now starting background updates")
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(s.jobs)
+		for waitPrecise(clock, stopper, interval, &triggerTime) {
+			s.round(triggerTime)
+		}
+	}()
+}
+
+func (s *updateScheduler) work(wg *sync.WaitGroup, stopper golib.StopChan) {
+	defer wg.Done()
+	for job := range s.jobs {
+		job.lag = s.graph.clock.Now().Sub(job.ready)
+		if !stopper.Stopped() {
+			if state, _ := s.graph.nodeState(job.node); state == CollectorActive {
+				// The result is not needed: failed nodes are removed from the graph and skipped in the following rounds
+				job.node.updateIfDue(stopper, s.lastUpdates[job.node])
+			}
+		}
+		s.results <- job
+	}
+}
+
+// round updates all nodes once, and returns after all nodes have been updated or skipped
+func (s *updateScheduler) round(start time.Time) {
+	remaining := make(map[*collectorNode]int, len(s.order))
+	for _, node := range s.order {
+		remaining[node] = s.dependencies[node]
+		if remaining[node] == 0 {
+			s.jobs <- scheduledUpdate{node: node, ready: start}
+		}
+	}
+	var maxLag time.Duration
+	for finished := 0; finished < len(s.order); finished++ {
+		result := <-s.results
+		if result.lag > maxLag {
+			maxLag = result.lag
+		}
+		now := s.graph.clock.Now()
+		for _, dependent := range s.dependents[result.node] {
+			remaining[dependent]--
+			if remaining[dependent] == 0 {
+				s.jobs <- scheduledUpdate{node: dependent, ready: now}
+			}
+		}
+	}
+	end := s.graph.clock.Now()
+	s.recordRound(start, end.Sub(start), maxLag)
+	if s.roundFinished != nil {
+		s.roundFinished(end)
+	}
+}
+
+func (s *updateScheduler) recordRound(start time.Time, duration time.Duration, lag time.Duration) {
+	s.statsLock.Lock()
+	defer s.statsLock.Unlock()
+	s.rounds++
+	s.lastRound = start
+	s.lastRoundDuration = duration
+	s.lastLag = lag
+	if lag > s.maxLag {
+		s.maxLag = lag
+	}
+}
+
+func (s *updateScheduler) statistics() SchedulerStatistics {
+	s.statsLock.Lock()
+	defer s.statsLock.Unlock()
+	return SchedulerStatistics{
+		Workers:         s.workers,
+		Collectors:      len(s.order),
+		Rounds:          s.rounds,
+		LastRound:       s.lastRound,
+		LastRoundMillis: float64(s.lastRoundDuration) / float64(time.Millisecond),
+		LastLagMillis:   float64(s.lastLag) / float64(time.Millisecond),
+		MaxLagMillis:    float64(s.maxLag) / float64(time.Millisecond),
+	}
+}
+
+// getSelfMonitoringMetrics creates metrics exposing the statistics of the scheduler.
+func (s *updateScheduler) getSelfMonitoringMetrics() (MetricSlice, MetricMetadataMap) {
+	prefix := SelfMonitoringPrefix + "scheduler/"
+	metrics := MetricSlice{
+		&Metric{name: prefix + "round_ms", reader: func() bitflow.Value {
+			return bitflow.Value(s.statistics().LastRoundMillis)
+		}},
+		&Metric{name: prefix + "lag_ms", reader: func() bitflow.Value {
+			return bitflow.Value(s.statistics().LastLagMillis)
+		}},
+	}
+	metadata := MetricMetadataMap{
+		prefix + "round_ms": GaugeMetric(UnitMillis, "Duration of the most recent update round of all collectors"),
+		prefix + "lag_ms":   GaugeMetric(UnitMillis, "Longest time a collector waited for a free worker in the most recent update round"),
+	}
+	return metrics, metadata
+}
@@ -0,0 +1,204 @@
+package collector
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/antongulenko/golib"
+	"github.com/stretchr/testify/suite"
+)
+
+// updateLog records the order and concurrency of Update() calls
+type updateLog struct {
+	lock       sync.Mutex
+	order      []string
+	running    int
+	maxRunning int
+}
+
+func (log *updateLog) started(name string) {
+	log.lock.Lock()
+	defer log.lock.Unlock()
+	log.order = append(log.order, name)
+	log.running++
+	if log.running > log.maxRunning {
+		log.maxRunning = log.running
+	}
+}
+
+func (log *updateLog) finished() {
+	log.lock.Lock()
+	defer log.lock.Unlock()
+	log.running--
+}
+
+func (log *updateLog) index(name string) int {
+	log.lock.Lock()
+	defer log.lock.Unlock()
+	for i, updated := range log.order {
+		if updated == name {
+			return i
+		}
+	}
+	return -1
+}
+
+type dependentCollector struct {
+	testCollector
+	depends []Collector
+	log     *updateLog
+
+	// If set, every Update() advances the clock, to simulate a slow collector
+	clock    *FakeClock
+	duration time.Duration
+}
+
+func (col *dependentCollector) Depends() []Collector {
+	return col.depends
+}
+
+func (col *dependentCollector) Update() error {
+	col.log.started(col.Name)
+	defer col.log.finished()
+	if col.clock != nil {
+		col.clock.Advance(col.duration)
+	}
+	return col.testCollector.Update()
+}
+
+type SchedulerTestSuite struct {
+	golib.AbstractTestSuite
+	clock *FakeClock
+	log   *updateLog
+}
+
+func TestScheduler(t *testing.T) {
+	suite.Run(t, new(SchedulerTestSuite))
+}
+
+func (suite *SchedulerTestSuite) SetupTest() {
+	suite.clock = NewFakeClock(time.Unix(1000, 0))
+	suite.log = new(updateLog)
+}
+
+func (suite *SchedulerTestSuite) newCollector(name string, depends ...Collector) *dependentCollector {
+	return &dependentCollector{
+		testCollector: testCollector{AbstractCollector: RootCollector(name)},
+		depends:       depends,
+		log:           suite.log,
+	}
+}
+
+func (suite *SchedulerTestSuite) newScheduler(workers int, cols ...Collector) (*updateScheduler, *sync.WaitGroup, golib.StopChan) {
+	graph, err := initCollectorGraph(cols)
+	suite.NoError(err)
+	graph = graph.clone()
+	graph.clock = suite.clock
+	scheduler := newUpdateScheduler(graph, workers)
+	var wg sync.WaitGroup
+	stopper := golib.NewStopChan()
+	for i := 0; i < scheduler.workers; i++ {
+		wg.Add(1)
+		go scheduler.work(&wg, stopper)
+	}
+	return scheduler, &wg, stopper
+}
+
+func (suite *SchedulerTestSuite) stop(scheduler *updateScheduler, wg *sync.WaitGroup, stopper golib.StopChan) {
+	stopper.Stop()
+	close(scheduler.jobs)
+	wg.Wait()
+}
+
+func (suite *SchedulerTestSuite) TestDependencyOrder() {
+	root := suite.newCollector("root")
+	left := suite.newCollector("left", root)
+	right := suite.newCollector("right", root)
+	leaf := suite.newCollector("leaf", left, right)
+	other := suite.newCollector("other")
+	scheduler, wg, stopper := suite.newScheduler(2, root, left, right, leaf, other)
+	defer suite.stop(scheduler, wg, stopper)
+
+	for round := 1; round <= 3; round++ {
+		scheduler.round(suite.clock.Now())
+		for _, col := range []*dependentCollector{root, left, right, leaf, other} {
+			suite.Equal(round, col.numUpdates(), col.Name)
+		}
+	}
+	suite.True(suite.log.index("root") < suite.log.index("left"))
+	suite.True(suite.log.index("root") < suite.log.index("right"))
+	suite.True(suite.log.index("left") < suite.log.index("leaf"))
+	suite.True(suite.log.index("right") < suite.log.index("leaf"))
+	suite.True(suite.log.maxRunning <= 2)
+	suite.Equal(uint64(3), scheduler.statistics().Rounds)
+}
+
+func (suite *SchedulerTestSuite) TestWorkersLimitedByCollectors() {
+	scheduler, wg, stopper := suite.newScheduler(10, suite.newCollector("a"), suite.newCollector("b"))
+	defer suite.stop(scheduler, wg, stopper)
+	suite.Equal(2, scheduler.statistics().Workers)
+	suite.Equal(2, scheduler.statistics().Collectors)
+}
+
+func (suite *SchedulerTestSuite) TestLag() {
+	first := suite.newCollector("first")
+	second := suite.newCollector("second")
+	for _, col := range []*dependentCollector{first, second} {
+		col.clock = suite.clock
+		col.duration = time.Second
+	}
+	scheduler, wg, stopper := suite.newScheduler(1, first, second)
+	defer suite.stop(scheduler, wg, stopper)
+
+	// With one worker, the second collector waits for the first one
+	scheduler.round(suite.clock.Now())
+	stats := scheduler.statistics()
+	suite.Equal(float64(2000), stats.LastRoundMillis)
+	suite.Equal(float64(1000), stats.LastLagMillis)
+	suite.Equal(float64(1000), stats.MaxLagMillis)
+}
+
+func (suite *SchedulerTestSuite) TestFailedDependency() {
+	root := suite.newCollector("root")
+	child := suite.newCollector("child", root)
+	other := suite.newCollector("other")
+	scheduler, wg, stopper := suite.newScheduler(2, root, child, other)
+	defer suite.stop(scheduler, wg, stopper)
+	scheduler.graph.applyRetryPolicies(RetryPolicy{ToleratedFailures: 1}, nil, time.Second)
+
+	root.setError(errors.New("update failed"))
+	scheduler.round(suite.clock.Now())
+	scheduler.round(suite.clock.Now())
+
+	// The child is removed from the graph together with its failed dependency
+	suite.Equal(1, root.numUpdates())
+	suite.Equal(0, child.numUpdates())
+	suite.Equal(2, other.numUpdates())
+	state, _ := scheduler.graph.nodeState(scheduler.graph.collectors[root])
+	suite.Equal(CollectorFailed, state)
+}
+
+func (suite *SchedulerTestSuite) TestStart() {
+	col := suite.newCollector("col")
+	graph, err := initCollectorGraph([]Collector{col})
+	suite.NoError(err)
+	graph = graph.clone()
+	graph.clock = suite.clock
+	scheduler := newUpdateScheduler(graph, 4)
+
+	var wg sync.WaitGroup
+	stopper := golib.NewStopChan()
+	scheduler.start(&wg, stopper, time.Second)
+	suite.Equal(1, col.numUpdates(), "the first round is performed synchronously")
+
+	suite.clock.WaitForTimers(1)
+	suite.clock.Advance(time.Second)
+	suite.clock.WaitForTimers(1)
+	suite.Equal(2, col.numUpdates())
+
+	stopper.Stop()
+	wg.Wait()
+	suite.Equal(uint64(2), scheduler.statistics().Rounds)
+}
@@ -0,0 +1,77 @@
+package collector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bitflow-stream/go-bitflow/bitflow"
+)
+
+// RoundTimeTag is attached to samples emitted with SampleSource.ConsistentSnapshots. It contains the time
+// when the update round finished, that the values of the sample were read after, in time.RFC3339Nano format.
+const RoundTimeTag = "round_time"
+
+// roundSnapshot reads the values of all metrics after every complete update round, see SampleSource.ConsistentSnapshots.
+// The sink only copies the values of the most recent snapshot, so a sample never mixes values of different rounds.
+type roundSnapshot struct {
+	lock      sync.Mutex
+	groups    []*sampleGroup
+	roundTime time.Time
+
+	// If tagMeasurementTime is set, the measurementTime() of every group is stored together with the values
+	tagMeasurementTime bool
+	measurementTimes   []time.Time
+
+	// Serializes update() with modifications of collectors outside of the update rounds, see modify()
+	modifyLock sync.Mutex
+}
+
+// update reads all metric values. It must be called while no collector is updated by the update rounds.
+// Collectors with an Update() call that has exceeded its timeout and is still running are skipped:
+// their metrics keep the values of the previous snapshot.
+func (snapshot *roundSnapshot) update(roundEnd time.Time) {
+	snapshot.modifyLock.Lock()
+	defer snapshot.modifyLock.Unlock()
+	snapshot.lock.Lock()
+	defer snapshot.lock.Unlock()
+	if snapshot.tagMeasurementTime {
+		snapshot.measurementTimes = make([]time.Time, len(snapshot.groups))
+	}
+	for i, group := range snapshot.groups {
+		if snapshot.tagMeasurementTime {
+			snapshot.measurementTimes[i] = group.measurementTime()
+		}
+		for _, metric := range group.metrics {
+			if metric.node == nil || !metric.node.hasPendingUpdate() {
+				metric.Update()
+			}
+		}
+	}
+	snapshot.roundTime = roundEnd
+}
+
+// modify runs the given function, which modifies collectors outside of the update rounds (e.g. when checking whether a
+// failed collector has recovered), while no snapshot is taken. The snapshot may be nil, if ConsistentSnapshots is not set.
+func (snapshot *roundSnapshot) modify(modify func()) {
+	if snapshot != nil {
+		snapshot.modifyLock.Lock()
+		defer snapshot.modifyLock.Unlock()
+	}
+	modify()
+}
+
+// makeSamples creates one sample per sampleGroup from the values of the most recent snapshot.
+func (snapshot *roundSnapshot) makeSamples(now time.Time) []*bitflow.Sample {
+	snapshot.lock.Lock()
+	defer snapshot.lock.Unlock()
+	roundTime := snapshot.roundTime.Format(time.RFC3339Nano)
+	samples := make([]*bitflow.Sample, len(snapshot.groups))
+	for i, group := range snapshot.groups {
+		samples[i] = group.newSample(now)
+		samples[i].SetTag(RoundTimeTag, roundTime)
+		if snapshot.tagMeasurementTime && snapshot.measurementTimes != nil {
+			setMeasurementTime(samples[i], snapshot.measurementTimes[i])
+		}
+	}
+	return samples
+}
@@ -0,0 +1,134 @@
+package collector
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/antongulenko/golib"
+	"github.com/bitflow-stream/go-bitflow/bitflow"
+	"github.com/stretchr/testify/suite"
+)
+
+// roundCollector delivers the number of its Update() calls as metric value
+type roundCollector struct {
+	dependentCollector
+}
+
+func (col *roundCollector) Metrics() MetricReaderMap {
+	return MetricReaderMap{col.Name: func() bitflow.Value {
+		return bitflow.Value(col.numUpdates())
+	}}
+}
+
+type SnapshotTestSuite struct {
+	golib.AbstractTestSuite
+	clock *FakeClock
+}
+
+func TestSnapshot(t *testing.T) {
+	suite.Run(t, new(SnapshotTestSuite))
+}
+
+func (suite *SnapshotTestSuite) SetupTest() {
+	suite.clock = NewFakeClock(time.Unix(1000, 0))
+}
+
+func (suite *SnapshotTestSuite) newCollector(name string, depends ...Collector) *roundCollector {
+	col := &roundCollector{}
+	col.AbstractCollector = RootCollector(name)
+	col.depends = depends
+	col.log = new(updateLog)
+	col.clock = suite.clock
+	col.duration = time.Second
+	return col
+}
+
+func (suite *SnapshotTestSuite) TestSnapshotAfterRound() {
+	parent := suite.newCollector("parent")
+	child := suite.newCollector("child", parent)
+	graph, err := initCollectorGraph([]Collector{parent, child})
+	suite.NoError(err)
+	graph = graph.clone()
+	graph.clock = suite.clock
+
+	source := new(SampleSource)
+	groups := source.createSampleGroups(graph.getMetrics())
+	snapshot := &roundSnapshot{groups: groups}
+	scheduler := newUpdateScheduler(graph, 2)
+	scheduler.roundFinished = snapshot.update
+
+	var wg sync.WaitGroup
+	stopper := golib.NewStopChan()
+	scheduler.start(&wg, stopper, 5*time.Second)
+	defer func() {
+		stopper.Stop()
+		wg.Wait()
+	}()
+
+	// Every update takes one second, so the first round finishes after two seconds
+	samples := snapshot.makeSamples(suite.clock.Now())
+	suite.Len(samples, 1)
+	suite.Equal([]string{"child", "parent"}, groups[0].header.Fields)
+	suite.Equal([]bitflow.Value{1, 1}, samples[0].Values)
+	suite.Equal(time.Unix(1002, 0).Format(time.RFC3339Nano), samples[0].Tag(RoundTimeTag))
+
+	// The second round starts five seconds after the first one
+	suite.clock.WaitForTimers(1)
+	suite.clock.Advance(3 * time.Second)
+	suite.clock.WaitForTimers(1)
+	samples = snapshot.makeSamples(suite.clock.Now())
+	suite.Equal([]bitflow.Value{2, 2}, samples[0].Values)
+	suite.Equal(time.Unix(1007, 0).Format(time.RFC3339Nano), samples[0].Tag(RoundTimeTag))
+}
+
+func (suite *SnapshotTestSuite) TestMeasurementTime() {
+	parent := suite.newCollector("parent")
+	child := suite.newCollector("child", parent)
+	graph, err := initCollectorGraph([]Collector{parent, child})
+	suite.NoError(err)
+	graph = graph.clone()
+	graph.clock = suite.clock
+
+	source := &SampleSource{TagMeasurementTime: true}
+	groups := source.createSampleGroups(graph.getMetrics())
+	suite.True(groups[0].measurementTime().IsZero())
+	snapshot := &roundSnapshot{groups: groups, tagMeasurementTime: true}
+	scheduler := newUpdateScheduler(graph, 2)
+	scheduler.roundFinished = snapshot.update
+
+	var wg sync.WaitGroup
+	stopper := golib.NewStopChan()
+	scheduler.start(&wg, stopper, 5*time.Second)
+	defer func() {
+		stopper.Stop()
+		wg.Wait()
+	}()
+
+	// The parent finishes after one second, the child after two seconds. The oldest measurement is reported.
+	suite.Equal(time.Unix(1001, 0), groups[0].measurementTime())
+	samples := snapshot.makeSamples(suite.clock.Now())
+	suite.Equal(time.Unix(1001, 0).Format(time.RFC3339Nano), samples[0].Tag(MeasurementTimeTag))
+}
+
+func (suite *SnapshotTestSuite) TestPendingUpdate() {
+	parent := suite.newCollector("parent")
+	child := suite.newCollector("child", parent)
+	graph, err := initCollectorGraph([]Collector{parent, child})
+	suite.NoError(err)
+	graph = graph.clone()
+
+	groups := new(SampleSource).createSampleGroups(graph.getMetrics())
+	snapshot := &roundSnapshot{groups: groups}
+	suite.NoError(parent.Update())
+	suite.NoError(child.Update())
+	snapshot.update(suite.clock.Now())
+	suite.Equal([]bitflow.Value{1, 1}, snapshot.makeSamples(suite.clock.Now())[0].Values)
+
+	// The Update() of the child has exceeded its timeout and might still modify the child, so its values are not read
+	graph.collectors[child].pendingUpdate = make(chan error, 1)
+	suite.NoError(parent.Update())
+	suite.NoError(child.Update())
+	snapshot.update(suite.clock.Now())
+	suite.Equal([]bitflow.Value{1, 2}, snapshot.makeSamples(suite.clock.Now())[0].Values)
+}
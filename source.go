@@ -3,6 +3,7 @@ package collector
 import (
 	"fmt"
 	"regexp"
+	"runtime"
 	"sort"
 	"strings"
 	"sync"
@@ -29,21 +30,138 @@ type SampleSource struct {
 	IncludeMetrics     []*regexp.Regexp
 	DisabledCollectors []string
 
+	// DisabledCollectorRegexes removes all collectors with names matching one of the regexes, like DisabledCollectors.
+	// Collectors depending on a disabled collector are removed as well.
+	DisabledCollectorRegexes []*regexp.Regexp
+
+	// TaggedSamples enables emitting a separate sample for every MetricEntity (see EntityCollector),
+	// instead of putting all metrics into one sample.
+	TaggedSamples bool
+
+	// MetricWindows adds rates over additional time windows for metrics matching the regexes.
+	// Only metrics of collectors implementing WindowedCollector are supported.
+	MetricWindows map[*regexp.Regexp]MetricWindows
+
+	// MissingValuesAsNaN makes metrics return NaN while the values of their collector are unknown: after a failed Update(),
+	// and while the collector has failed entirely or has been removed because of a failed dependency. The metrics of
+	// failed collectors are kept when restarting the metric collection, so the set of emitted metrics stays stable.
+	MissingValuesAsNaN bool
+
+	// PinnedHeader fixes the fields of the emitted samples, so that the header does not change when the metric collection
+	// is restarted. Pinned fields that are not collected are emitted as NaN, and metrics that are not pinned are dropped.
+	// If PinFirstHeader is set and PinnedHeader is empty, the PinnedHeader is set to the fields of the first collection round.
+	// Both options are not supported together with TaggedSamples.
+	PinnedHeader   []string
+	PinFirstHeader bool
+
+	// AlignSinkTicks emits samples at multiples of the SinkInterval since the zero time (for example at every full 500ms),
+	// and timestamps them with the aligned time instead of the current time. This keeps the timestamps of different hosts comparable.
+	AlignSinkTicks bool
+
+	// TagMeasurementTime attaches the MeasurementTimeTag to every sample, containing the time of the oldest
+	// measurement among the collectors that contribute metrics to the sample.
+	TagMeasurementTime bool
+
+	// Spool optionally buffers samples on disk while the sink returns errors, and replays them once the sink recovers.
+	Spool *Spool
+
+	// SelfMonitoring adds metrics describing the collectors themselves (update duration, failures, etc.),
+	// prefixed with SelfMonitoringPrefix. The metrics are not affected by ExcludeMetrics and IncludeMetrics.
+	SelfMonitoring bool
+
+	// UpdateTimeout limits the duration of every Update() call. A collector that does not return in time is treated
+	// as failed for that update, which allows its dependents to proceed. UpdateTimeouts overrides the timeout for
+	// collectors matching the regexes. A timeout <= 0 disables the limit. Every limited Update() call runs in an additional
+	// goroutine, so timeouts should only be set for collectors that can hang, e.g. because of remote connections.
+	UpdateTimeout  time.Duration
+	UpdateTimeouts map[*regexp.Regexp]time.Duration
+
+	// RetryPolicy configures the handling of update failures. RetryPolicies overrides the policy for collectors
+	// matching the regexes. Unset fields default to ToleratedUpdateFailures and FailedCollectorCheckInterval.
+	// Note that failed collectors are checked at most every FailedCollectorCheckInterval, regardless of the policy.
+	RetryPolicy   RetryPolicy
+	RetryPolicies map[*regexp.Regexp]RetryPolicy
+
 	FailedCollectorCheckInterval   time.Duration
 	FilteredCollectorCheckInterval time.Duration
 
-	loopTask       *golib.LoopTask
-	currentMetrics []string
+	// Clock is used for scheduling updates and timestamping samples. Defaults to RealClock.
+	Clock Clock
+
+	// UpdateWorkers limits the number of goroutines updating the collectors. By default, every collector is updated by
+	// a dedicated goroutine. With a positive value, the collectors are updated by the given number of workers,
+	// in the topological order of their dependencies. This reduces the overhead with thousands of collectors.
+	UpdateWorkers int
+
+	// ConsistentSnapshots makes sure that every sample contains metric values of one complete update round:
+	// the values are read after all collectors have been updated, instead of at every SinkInterval.
+	// The samples are tagged with the time the update round finished (RoundTimeTag).
+	// This requires updating the collectors in rounds, so a pool of workers is used even if UpdateWorkers is not set.
+	ConsistentSnapshots bool
+
+	loopTask    *golib.LoopTask
+	reconfigure chan *reconfiguration
+
+	// All initialized collectors. The graph is reused when the metric collection is restarted,
+	// only the collectors with changed metrics are initialized again.
+	graph             *collectorGraph
+	changedCollectors []*collectorNode
+
+	// The graph, metrics and metadata of the current collection round, and the scheduler if UpdateWorkers is set.
+	// Protected by currentGraphLock, since they are read by the REST API.
+	currentGraph     *collectorGraph
+	currentScheduler *updateScheduler
+	currentMetrics   []string
+	currentMetadata  MetricMetadataMap
+	currentGraphLock sync.Mutex
+
+	// The most recently emitted samples, see WritePrometheus()
+	latest latestSamples
 }
 
 func (source *SampleSource) String() string {
 	return fmt.Sprintf("CollectorSource (%v root-collectors)", len(source.RootCollectors))
 }
 
+func (source *SampleSource) getClock() Clock {
+	return clockOrDefault(source.Clock)
+}
+
 func (source *SampleSource) CurrentMetrics() []string {
+	source.currentGraphLock.Lock()
+	defer source.currentGraphLock.Unlock()
 	return source.currentMetrics
 }
 
+// CurrentMetadata returns the metadata of all currently collected metrics that are described by their collectors.
+func (source *SampleSource) CurrentMetadata() MetricMetadataMap {
+	source.currentGraphLock.Lock()
+	defer source.currentGraphLock.Unlock()
+	return source.currentMetadata
+}
+
+// CollectorStatistics returns the state and update statistics of all collectors in the current collection round.
+func (source *SampleSource) CollectorStatistics() []CollectorStatistics {
+	graph := source.getCurrentGraph()
+	if graph == nil {
+		return nil
+	}
+	return graph.statistics()
+}
+
+// SchedulerStatistics returns the statistics of the update rounds in the current collection round,
+// or nil if UpdateWorkers is not set.
+func (source *SampleSource) SchedulerStatistics() *SchedulerStatistics {
+	source.currentGraphLock.Lock()
+	scheduler := source.currentScheduler
+	source.currentGraphLock.Unlock()
+	if scheduler == nil {
+		return nil
+	}
+	stats := scheduler.statistics()
+	return &stats
+}
+
 func (source *SampleSource) Start(wg *sync.WaitGroup) golib.StopChan {
 	for name, val := range map[string]time.Duration{
 		"CollectInterval":                source.CollectInterval,
@@ -55,73 +173,210 @@ func (source *SampleSource) Start(wg *sync.WaitGroup) golib.StopChan {
 			return golib.NewStoppedChan(fmt.Errorf("The field CollectorSource.%v must be set to a positive value (have %v)", name, val))
 		}
 	}
+	if source.TaggedSamples && (len(source.PinnedHeader) > 0 || source.PinFirstHeader) {
+		return golib.NewStoppedChan(fmt.Errorf("%v: A pinned header is not supported together with tagged samples", source))
+	}
 
+	source.reconfigure = make(chan *reconfiguration)
 	source.loopTask = &golib.LoopTask{
 		Description: source.String(),
 		StopHook: func() {
 			source.CloseSinkParallel(wg)
 		},
 		Loop: func(loopStop golib.StopChan) error {
-			var collectWg sync.WaitGroup
-			collectionStop, err := source.collect(&collectWg)
+			graph, err := source.createFilteredGraph()
 			if err != nil {
 				return err
 			}
+			var collectWg sync.WaitGroup
+			var reconfig *reconfiguration
+			collectionStop := source.collect(&collectWg, graph)
 			select {
 			case <-collectionStop.WaitChan():
 			case <-loopStop.WaitChan():
+			case reconfig = <-source.reconfigure:
 			}
 			collectionStop.Stop()
 			collectWg.Wait()
+			source.changedCollectors = graph.changedNodes()
+			if reconfig != nil {
+				reconfig.modify()
+				close(reconfig.done)
+			}
 			return nil
 		},
 	}
 	return source.loopTask.Start(wg)
 }
 
-func (source *SampleSource) Close() {
-	source.loopTask.Stop()
+type reconfiguration struct {
+	modify func()
+	done   chan struct{}
 }
 
-func (source *SampleSource) collect(wg *sync.WaitGroup) (golib.StopChan, error) {
-	graph, err := source.createFilteredGraph()
-	if err != nil {
-		return golib.StopChan{}, err
+// Reconfigure stops the current collection round, invokes the given function, and starts a new collection round.
+// The function can safely modify the exported fields of the SampleSource, including RootCollectors.
+// Only the collectors affected by the modification are initialized again. Reconfigure returns after the function
+// has been executed. An error is returned if the SampleSource has already been stopped.
+func (source *SampleSource) Reconfigure(modify func()) error {
+	if source.loopTask == nil {
+		// Not started yet
+		modify()
+		return nil
+	}
+	reconfig := &reconfiguration{modify: modify, done: make(chan struct{})}
+	select {
+	case source.reconfigure <- reconfig:
+		<-reconfig.done
+		return nil
+	case <-source.loopTask.WaitChan():
+		return fmt.Errorf("%v has already been stopped", source)
 	}
+}
+
+func (source *SampleSource) Close() {
+	source.loopTask.Stop()
+}
 
+func (source *SampleSource) collect(wg *sync.WaitGroup, graph *collectorGraph) golib.StopChan {
 	metrics := graph.getMetrics()
-	fields, getValues := metrics.ConstructSample(source)
+	metadata := graph.getMetadata()
+	windowMetrics, windowMetadata := graph.getWindowedMetrics(source.MetricWindows)
+	metrics = append(metrics, windowMetrics...)
+	for name, meta := range windowMetadata {
+		metadata[name] = meta
+	}
+	if source.MissingValuesAsNaN {
+		missing := graph.getMissingNodes(source.ExcludeMetrics, source.IncludeMetrics)
+		missingWindowMetrics, missingWindowMetadata := getWindowedMetrics(missing, source.MetricWindows)
+		metrics = append(metrics, getMetrics(missing)...)
+		metrics = append(metrics, missingWindowMetrics...)
+		for _, missingMetadata := range []MetricMetadataMap{getMetadata(missing), missingWindowMetadata} {
+			for name, meta := range missingMetadata {
+				metadata[name] = meta
+			}
+		}
+		metrics.readMissingAsNaN()
+	}
+	var scheduler *updateScheduler
+	if source.UpdateWorkers > 0 || source.ConsistentSnapshots {
+		workers := source.UpdateWorkers
+		if workers <= 0 {
+			workers = runtime.NumCPU()
+		}
+		scheduler = newUpdateScheduler(graph, workers)
+	}
+	if source.SelfMonitoring {
+		selfMetrics, selfMetadata := graph.getSelfMonitoringMetrics()
+		if scheduler != nil {
+			schedulerMetrics, schedulerMetadata := scheduler.getSelfMonitoringMetrics()
+			selfMetrics = append(selfMetrics, schedulerMetrics...)
+			for name, meta := range schedulerMetadata {
+				selfMetadata[name] = meta
+			}
+		}
+		if source.Spool != nil {
+			spoolMetrics, spoolMetadata := source.Spool.getSelfMonitoringMetrics()
+			selfMetrics = append(selfMetrics, spoolMetrics...)
+			for name, meta := range spoolMetadata {
+				selfMetadata[name] = meta
+			}
+		}
+		metrics = append(metrics, selfMetrics...)
+		for name, meta := range selfMetadata {
+			metadata[name] = meta
+		}
+	}
+	metrics = source.pinMetrics(metrics)
+	graph.prepareDescription()
+	source.currentGraphLock.Lock()
+	source.currentMetrics = metrics.names()
+	source.currentMetadata = metadata
+	source.currentGraph = graph
+	source.currentScheduler = scheduler
+	source.currentGraphLock.Unlock()
+	groups := source.createSampleGroups(metrics)
+	var snapshot *roundSnapshot
+	if source.ConsistentSnapshots {
+		snapshot = &roundSnapshot{groups: groups, tagMeasurementTime: source.TagMeasurementTime}
+		scheduler.roundFinished = snapshot.update
+	}
 	log.Println("Collecting", len(metrics), "metrics through", len(graph.collectors), "collectors")
+	if source.TaggedSamples {
+		log.Println("Emitting", len(groups), "tagged samples per sink interval")
+	}
 	graph.applyUpdateFrequencies(source.UpdateFrequencies)
+	graph.applyUpdateTimeouts(source.UpdateTimeout, source.UpdateTimeouts)
+	graph.applyRetryPolicies(source.RetryPolicy, source.RetryPolicies, source.FailedCollectorCheckInterval)
 
+	graph.clock = source.getClock()
 	stopper := golib.NewStopChan()
-	source.startUpdates(wg, stopper, graph)
+	if scheduler != nil {
+		scheduler.start(wg, stopper, source.CollectInterval)
+	} else {
+		source.startUpdates(wg, stopper, graph)
+	}
 	source.watchFilteredCollectors(wg, stopper, graph)
-	source.watchFailedCollectors(wg, stopper, graph)
+	source.watchFailedCollectors(wg, stopper, graph, snapshot)
 	wg.Add(1)
-	go source.sinkMetrics(wg, metrics, fields, getValues, stopper)
-	return stopper, nil
+	go source.sinkMetrics(wg, groups, snapshot, stopper)
+	return stopper
 }
 
+// createGraph returns a copy of the graph of all initialized collectors. After the first call, the graph is reused:
+// only collectors that reported changed metrics in the previous collection round are initialized again,
+// and root collectors are initialized or removed according to RootCollectors, DisabledCollectors and DisabledCollectorRegexes.
 func (source *SampleSource) createGraph() (*collectorGraph, error) {
+	if source.graph != nil {
+		err := source.graph.reinitNodes(source.changedCollectors)
+		if err == nil {
+			err = source.graph.updateRoots(source.enabledRootCollectors())
+		}
+		if err != nil {
+			log.Warnln("Failed to re-initialize changed collectors, re-initializing all collectors:", err)
+			source.graph = nil
+		}
+	}
+	source.changedCollectors = nil
+	if source.graph == nil {
+		graph, err := source.initGraph()
+		if err != nil {
+			return nil, err
+		}
+		source.graph = graph
+	}
+	return source.graph.clone(), nil
+}
+
+func (source *SampleSource) initGraph() (*collectorGraph, error) {
+	return initCollectorGraph(source.enabledRootCollectors())
+}
+
+func (source *SampleSource) enabledRootCollectors() []Collector {
 	roots := make([]Collector, 0, len(source.RootCollectors))
 	for _, root := range source.RootCollectors {
-		name := root.String()
-		isEnabled := true
-		for _, disabled := range source.DisabledCollectors {
-			// Disabled root collectors are ignored immediately
-			if name == disabled {
-				isEnabled = false
-				break
-			}
-		}
-		if isEnabled {
-			roots = append(roots, root)
-		} else {
+		// Disabled root collectors are ignored immediately
+		if name := root.String(); source.isCollectorDisabled(name) {
 			log.Debugln("Disabling root collector", name)
+		} else {
+			roots = append(roots, root)
+		}
+	}
+	return roots
+}
+
+func (source *SampleSource) isCollectorDisabled(name string) bool {
+	for _, disabled := range source.DisabledCollectors {
+		if name == disabled {
+			return true
 		}
 	}
-	return initCollectorGraph(roots)
+	for _, regex := range source.DisabledCollectorRegexes {
+		if regex.MatchString(name) {
+			return true
+		}
+	}
+	return false
 }
 
 func (source *SampleSource) createFilteredGraph() (*collectorGraph, error) {
@@ -130,36 +385,92 @@ func (source *SampleSource) createFilteredGraph() (*collectorGraph, error) {
 		return nil, err
 	}
 	graph.applyMetricFilters(source.ExcludeMetrics, source.IncludeMetrics)
-	graph.applyCollectorFilters(source.DisabledCollectors)
+	graph.applyCollectorFilters(source.isCollectorDisabled)
 	graph.pruneAndRepair()
 	return graph, nil
 }
 
-func (source *SampleSource) sinkMetrics(wg *sync.WaitGroup, metrics MetricSlice, fields []string, getValues func() []bitflow.Value, stopper golib.StopChan) {
+func (source *SampleSource) sinkMetrics(wg *sync.WaitGroup, groups []*sampleGroup, snapshot *roundSnapshot, stopper golib.StopChan) {
 	defer wg.Done()
-
-	source.currentMetrics = fields
-	header := &bitflow.Header{Fields: fields}
 	sink := source.GetSink()
 
-	sinkTime := time.Now()
+	clock := source.getClock()
+	sinkTime := clock.Now()
+	wait := waitPrecise
+	if source.AlignSinkTicks {
+		wait = waitAligned
+		if !wait(clock, stopper, source.SinkInterval, &sinkTime) {
+			return
+		}
+	}
+	samples := make([]*bitflow.Sample, len(groups))
 	for {
-		metrics.UpdateAll()
-		values := getValues()
-		sample := &bitflow.Sample{
-			Time:   time.Now(),
-			Values: values,
+		now := clock.Now()
+		if source.AlignSinkTicks {
+			now = sinkTime
 		}
-		if err := sink.Sample(sample, header); err != nil {
-			log.Warnln("Failed to sink", len(values), "metrics:", err)
+		if snapshot != nil {
+			samples = snapshot.makeSamples(now)
+		} else {
+			for i, group := range groups {
+				var measurement time.Time
+				if source.TagMeasurementTime {
+					// Determined before reading the values, so that all values are at least as recent
+					measurement = group.measurementTime()
+				}
+				samples[i] = group.makeSample(now)
+				setMeasurementTime(samples[i], measurement)
+			}
+		}
+		source.latest.set(groups, samples)
+		for i, sample := range samples {
+			source.emitSample(sink, sample, groups[i].header)
 		}
-		if !stopper.WaitTimeoutPrecise(source.SinkInterval, timeoutLoopFactor, &sinkTime) {
+		if !wait(clock, stopper, source.SinkInterval, &sinkTime) {
 			return
 		}
 	}
 }
 
+// emitSample forwards the sample to the sink. If a Spool is configured, failed samples are spooled, and spooled samples
+// are replayed first to keep the order of the samples.
+func (source *SampleSource) emitSample(sink bitflow.SampleProcessor, sample *bitflow.Sample, header *bitflow.Header) {
+	spool := source.Spool
+	if spool == nil {
+		if err := sink.Sample(sample, header); err != nil {
+			log.Warnln("Failed to sink", len(sample.Values), "metrics:", err)
+		}
+		return
+	}
+	err := source.replaySpool(sink, spool)
+	if err == nil {
+		err = sink.Sample(sample, header)
+	}
+	if err != nil {
+		if spool.Samples() == 0 {
+			log.Warnln("Failed to sink", len(sample.Values), "metrics, spooling samples until the sink recovers:", err)
+		}
+		if spoolErr := spool.Add(sample, header); spoolErr != nil {
+			log.Warnln("Failed to spool", len(sample.Values), "metrics:", spoolErr)
+		}
+	}
+}
+
+func (source *SampleSource) replaySpool(sink bitflow.SampleProcessor, spool *Spool) error {
+	if spool.Samples() == 0 {
+		return nil
+	}
+	replayed, err := spool.Replay(sink.Sample)
+	if replayed > 0 {
+		log.Println("Replayed", replayed, "spooled samples,", spool.Samples(), "samples remaining")
+	}
+	return err
+}
+
 func (source *SampleSource) startUpdates(wg *sync.WaitGroup, stopper golib.StopChan, graph *collectorGraph) {
+	for node := range graph.nodes {
+		node.resetConditions()
+	}
 	roots, leafs := graph.getRootsAndLeafs()
 	log.Debugln("Root collectors:", len(roots), roots)
 	log.Debugln("Leaf collectors:", len(leafs), leafs)
@@ -201,10 +512,11 @@ func (source *SampleSource) startUpdates(wg *sync.WaitGroup, stopper golib.StopC
 				source.setAll(node.preconditions)
 			}
 		}()
-		triggerTime := time.Now()
+		clock := source.getClock()
+		triggerTime := clock.Now()
 		for {
 			source.setAll(rootConditions)
-			if !stopper.WaitTimeoutPrecise(source.CollectInterval, timeoutLoopFactor, &triggerTime) {
+			if !waitPrecise(clock, stopper, source.CollectInterval, &triggerTime) {
 				break
 			}
 		}
@@ -228,10 +540,11 @@ func (source *SampleSource) watchFilteredCollectors(wg *sync.WaitGroup, stopper
 		err := node.collector.MetricsChanged()
 		if err == MetricsChanged {
 			log.Warnln("Metrics of", node, "(filtered) have changed! Restarting metric collection.")
+			graph.collectorMetricsChanged(node)
 			stopper.Stop()
 		} else if err == nil {
 			// Reset the update failure counter since there was no error
-			node.failedUpdates = 0
+			node.resetFailedUpdates()
 		} else {
 			log.Warnln("Update of", node, "(filtered) failed:", err)
 			if node.updateFailed() {
@@ -244,7 +557,7 @@ func (source *SampleSource) watchFilteredCollectors(wg *sync.WaitGroup, stopper
 	})
 }
 
-func (source *SampleSource) watchFailedCollectors(wg *sync.WaitGroup, stopper golib.StopChan, graph *collectorGraph) {
+func (source *SampleSource) watchFailedCollectors(wg *sync.WaitGroup, stopper golib.StopChan, graph *collectorGraph, snapshot *roundSnapshot) {
 	var previousList []*collectorNode
 	source.loopCheck(wg, stopper, &graph.failedList, source.FailedCollectorCheckInterval, func(node *collectorNode) {
 		// Check if graph.failedList changed in any way
@@ -253,14 +566,31 @@ func (source *SampleSource) watchFailedCollectors(wg *sync.WaitGroup, stopper go
 			previousList = graph.failedList
 		}
 
+		now := graph.clock.Now()
+		if !node.retryDue(now) {
+			return
+		}
 		var err error
-		if node.isInitialized() {
-			err = node.collector.Update()
+		initialized := node.isInitialized()
+		snapshot.modify(func() {
+			if initialized {
+				err = node.callUpdate()
+			} else {
+				_, err = node.init()
+			}
+		})
+		if err != nil {
+			node.retryFailed(now)
 		} else {
-			_, err = node.init()
-		}
-		if err == nil {
 			log.Warnln("Collector", node, "is not failing anymore. Restarting metric collection.")
+			node.resetRetry()
+			if initialized {
+				node.resetFailedUpdates()
+				node.hasFailed = false
+			} else {
+				// The sub-collectors returned by Init() are created when re-initializing the node
+				graph.collectorMetricsChanged(node)
+			}
 			stopper.Stop()
 		}
 	})
@@ -270,7 +600,8 @@ func (source *SampleSource) loopCheck(wg *sync.WaitGroup, stopper golib.StopChan
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		checkTime := time.Now()
+		clock := source.getClock()
+		checkTime := clock.Now()
 		for {
 			for _, node := range *nodes {
 				check(node)
@@ -278,7 +609,7 @@ func (source *SampleSource) loopCheck(wg *sync.WaitGroup, stopper golib.StopChan
 					return
 				}
 			}
-			if !stopper.WaitTimeoutPrecise(interval, timeoutLoopFactor, &checkTime) {
+			if !waitPrecise(clock, stopper, interval, &checkTime) {
 				return
 			}
 		}
@@ -291,6 +622,7 @@ func (source *SampleSource) PrintMetrics() error {
 		return err
 	}
 	all := graph.listMetricNames()
+	metadata := graph.getMetadata()
 	graph.applyMetricFilters(source.ExcludeMetrics, source.IncludeMetrics)
 	filtered := graph.listMetricNames()
 	sort.Strings(all)
@@ -301,18 +633,21 @@ func (source *SampleSource) PrintMetrics() error {
 		if isIncluded {
 			i++
 		}
+		line := metric
 		if !isIncluded {
-			fmt.Println(metric, "(excluded)")
-		} else {
-			fmt.Println(metric)
+			line += " (excluded)"
+		}
+		if meta, ok := metadata[metric]; ok {
+			line += "\t[" + meta.String() + "]"
 		}
+		fmt.Println(line)
 	}
 	return nil
 }
 
 func (source *SampleSource) getGraphForPrinting(fullGraph bool) (*collectorGraph, error) {
 	if fullGraph {
-		return source.createGraph()
+		return source.initGraph()
 	} else {
 		return source.createFilteredGraph()
 	}
@@ -0,0 +1,371 @@
+package collector
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bitflow-stream/go-bitflow/bitflow"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	spoolFilePrefix = "spool-"
+	spoolFileSuffix = ".gob"
+
+	// Every segment file holds a fraction of Spool.MaxBytes, so that dropping the oldest segment frees enough space
+	spoolSegmentsPerSpool = 8
+	minSpoolSegmentBytes  = 64 * 1024
+)
+
+// Spool buffers samples in files on disk while the sink of a SampleSource fails, see SampleSource.Spool.
+// The samples are replayed in order once the sink accepts samples again. The spool is bounded: when the files exceed
+// MaxBytes, the oldest samples are dropped, and samples older than MaxAge are dropped before replaying them.
+// Samples spooled by a previous process using the same directory are replayed as well.
+type Spool struct {
+	Dir      string
+	MaxBytes int64
+	MaxAge   time.Duration // Zero or negative to keep samples regardless of their age
+
+	// Clock is used for checking the age of spooled samples. Defaults to RealClock.
+	Clock Clock
+
+	lock     sync.Mutex
+	segments []*spoolSegment // Oldest first. The last segment is written to, if its encoder is set.
+	dropped  uint64
+	sequence int // Distinguishes files created at the same time
+}
+
+type spoolSegment struct {
+	path     string
+	bytes    int64
+	samples  int
+	replayed int // Samples at the beginning of the file that have already been delivered
+	newest   time.Time
+
+	// Only set for the segment that new samples are appended to
+	file       *os.File
+	encoder    *gob.Encoder
+	lastFields []string
+}
+
+// spoolRecord is the gob-encoded form of one sample. Fields are only stored when the header changes within a segment.
+type spoolRecord struct {
+	Fields []string
+	Time   time.Time
+	Tags   map[string]string
+	Values []bitflow.Value
+}
+
+// NewSpool creates the given directory if necessary, and loads the segment files left there by a previous process.
+func NewSpool(dir string, maxBytes int64, maxAge time.Duration) (*Spool, error) {
+	if maxBytes <= 0 {
+		return nil, fmt.Errorf("The maximum spool size must be positive (have %v)", maxBytes)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("Failed to create spool directory: %v", err)
+	}
+	spool := &Spool{Dir: dir, MaxBytes: maxBytes, MaxAge: maxAge}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read spool directory: %v", err)
+	}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasPrefix(file.Name(), spoolFilePrefix) || !strings.HasSuffix(file.Name(), spoolFileSuffix) {
+			continue
+		}
+		segment := &spoolSegment{path: filepath.Join(dir, file.Name()), bytes: file.Size()}
+		err := segment.read(func(record *spoolRecord, _ []string) bool {
+			segment.samples++
+			segment.newest = record.Time
+			return true
+		})
+		if err != nil {
+			// For example, the process was killed while writing the last record
+			log.Warnf("Failed to read spool file %v, only %v samples can be replayed: %v", segment.path, segment.samples, err)
+		}
+		spool.segments = append(spool.segments, segment)
+	}
+	// The file names contain the creation time
+	sort.Slice(spool.segments, func(i, j int) bool {
+		return spool.segments[i].path < spool.segments[j].path
+	})
+	if samples := spool.Samples(); samples > 0 {
+		log.Println("Loaded", samples, "spooled samples from", dir)
+	}
+	return spool, nil
+}
+
+func (spool *Spool) clock() Clock {
+	return clockOrDefault(spool.Clock)
+}
+
+// Samples returns the number of samples that have not been replayed yet.
+func (spool *Spool) Samples() int {
+	spool.lock.Lock()
+	defer spool.lock.Unlock()
+	res := 0
+	for _, segment := range spool.segments {
+		res += segment.samples - segment.replayed
+	}
+	return res
+}
+
+// Bytes returns the total size of the spool files.
+func (spool *Spool) Bytes() int64 {
+	spool.lock.Lock()
+	defer spool.lock.Unlock()
+	var res int64
+	for _, segment := range spool.segments {
+		res += segment.bytes
+	}
+	return res
+}
+
+// Dropped returns the number of samples that have been dropped due to MaxBytes or MaxAge.
+func (spool *Spool) Dropped() uint64 {
+	spool.lock.Lock()
+	defer spool.lock.Unlock()
+	return spool.dropped
+}
+
+// Add appends the sample to the spool, and drops the oldest samples if the spool exceeds MaxBytes.
+func (spool *Spool) Add(sample *bitflow.Sample, header *bitflow.Header) error {
+	spool.lock.Lock()
+	defer spool.lock.Unlock()
+	segment, err := spool.writeSegment()
+	if err != nil {
+		return err
+	}
+	record := spoolRecord{Time: sample.Time, Tags: sample.TagMap(), Values: sample.Values}
+	if !equalFields(segment.lastFields, header.Fields) {
+		record.Fields = header.Fields
+		segment.lastFields = header.Fields
+	}
+	if err := segment.encoder.Encode(&record); err != nil {
+		// The file might contain a partial record, so do not write to it anymore
+		segment.close()
+		return fmt.Errorf("Failed to write spool file %v: %v", segment.path, err)
+	}
+	if info, err := segment.file.Stat(); err == nil {
+		segment.bytes = info.Size()
+	}
+	segment.samples++
+	segment.newest = sample.Time
+	spool.limitSize()
+	return nil
+}
+
+// Close closes the file that new samples are appended to. Spooled samples are kept on disk, and Add reopens a new file.
+func (spool *Spool) Close() {
+	spool.lock.Lock()
+	defer spool.lock.Unlock()
+	if len(spool.segments) > 0 {
+		spool.segments[len(spool.segments)-1].close()
+	}
+}
+
+func (spool *Spool) writeSegment() (*spoolSegment, error) {
+	if len(spool.segments) > 0 {
+		last := spool.segments[len(spool.segments)-1]
+		if last.encoder != nil && last.bytes < spool.segmentBytes() {
+			return last, nil
+		}
+		last.close()
+	}
+	spool.sequence++
+	name := fmt.Sprintf("%v%020d-%06d%v", spoolFilePrefix, spool.clock().Now().UnixNano(), spool.sequence%1000000, spoolFileSuffix)
+	path := filepath.Join(spool.Dir, name)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create spool file: %v", err)
+	}
+	segment := &spoolSegment{path: path, file: file, encoder: gob.NewEncoder(file)}
+	spool.segments = append(spool.segments, segment)
+	return segment, nil
+}
+
+func (spool *Spool) segmentBytes() int64 {
+	size := spool.MaxBytes / spoolSegmentsPerSpool
+	if size < minSpoolSegmentBytes {
+		size = minSpoolSegmentBytes
+	}
+	return size
+}
+
+// limitSize drops the oldest segments while the spool is larger than MaxBytes. The segment that is currently written is kept.
+func (spool *Spool) limitSize() {
+	var total int64
+	for _, segment := range spool.segments {
+		total += segment.bytes
+	}
+	for total > spool.MaxBytes && len(spool.segments) > 1 {
+		oldest := spool.segments[0]
+		total -= oldest.bytes
+		spool.dropSegment(oldest, "the spool exceeds "+fmt.Sprint(spool.MaxBytes)+" bytes")
+	}
+}
+
+func (spool *Spool) dropSegment(segment *spoolSegment, reason string) {
+	dropped := segment.samples - segment.replayed
+	if dropped > 0 {
+		log.Warnln("Dropping", dropped, "spooled samples, because", reason)
+	}
+	spool.dropped += uint64(dropped)
+	spool.removeSegment(segment)
+}
+
+func (spool *Spool) removeSegment(segment *spoolSegment) {
+	segment.close()
+	if err := os.Remove(segment.path); err != nil && !os.IsNotExist(err) {
+		log.Warnln("Failed to remove spool file:", err)
+	}
+	for i, other := range spool.segments {
+		if other == segment {
+			spool.segments = append(spool.segments[:i:i], spool.segments[i+1:]...)
+			break
+		}
+	}
+}
+
+// Replay passes all spooled samples in order to the given sink function, and removes them from the spool. Replaying stops
+// at the first error returned by the sink, and the failed sample is replayed again next time. Samples older than
+// MaxAge are dropped. Replay returns the number of delivered samples.
+func (spool *Spool) Replay(sink func(sample *bitflow.Sample, header *bitflow.Header) error) (int, error) {
+	spool.lock.Lock()
+	defer spool.lock.Unlock()
+	var minTime time.Time
+	if spool.MaxAge > 0 {
+		minTime = spool.clock().Now().Add(-spool.MaxAge)
+	}
+	headers := make(map[string]*bitflow.Header)
+	delivered := 0
+	for len(spool.segments) > 0 {
+		segment := spool.segments[0]
+		segment.close() // Samples added during the replay go into a new segment
+		reason := "they are older than " + spool.MaxAge.String()
+		if segment.newest.Before(minTime) {
+			log.Debugln("All samples in spool file", segment.path, "are older than", spool.MaxAge)
+		} else {
+			var sinkErr error
+			index := 0
+			err := segment.read(func(record *spoolRecord, fields []string) bool {
+				index++
+				if index <= segment.replayed {
+					return true
+				}
+				if record.Time.Before(minTime) {
+					spool.dropped++
+				} else {
+					sample := &bitflow.Sample{Time: record.Time, Values: record.Values}
+					for key, value := range record.Tags {
+						sample.SetTag(key, value)
+					}
+					if sinkErr = sink(sample, spoolHeader(headers, fields)); sinkErr != nil {
+						return false
+					}
+					delivered++
+				}
+				segment.replayed = index
+				return true
+			})
+			if sinkErr != nil {
+				return delivered, sinkErr
+			}
+			if err != nil {
+				reason = fmt.Sprintf("spool file %v could not be read: %v", segment.path, err)
+			}
+		}
+		spool.dropSegment(segment, reason)
+	}
+	return delivered, nil
+}
+
+func spoolHeader(headers map[string]*bitflow.Header, fields []string) *bitflow.Header {
+	// Samples with the same fields share one header instance, so that sinks do not detect a header change
+	key := strings.Join(fields, "\n")
+	header, ok := headers[key]
+	if !ok {
+		header = &bitflow.Header{Fields: fields}
+		headers[key] = header
+	}
+	return header
+}
+
+// read decodes all records in the segment file and passes them to the callback, together with the fields of
+// their header, until the callback returns false.
+func (segment *spoolSegment) read(callback func(record *spoolRecord, fields []string) bool) error {
+	file, err := os.Open(segment.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	decoder := gob.NewDecoder(file)
+	var fields []string
+	for {
+		var record spoolRecord
+		if err := decoder.Decode(&record); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if record.Fields != nil {
+			fields = record.Fields
+		}
+		if !callback(&record, fields) {
+			return nil
+		}
+	}
+}
+
+func (segment *spoolSegment) close() {
+	if segment.file != nil {
+		if err := segment.file.Close(); err != nil {
+			log.Warnln("Failed to close spool file:", err)
+		}
+		segment.file = nil
+		segment.encoder = nil
+		segment.lastFields = nil
+	}
+}
+
+func equalFields(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// getSelfMonitoringMetrics creates metrics describing the state of the spool.
+func (spool *Spool) getSelfMonitoringMetrics() (MetricSlice, MetricMetadataMap) {
+	prefix := SelfMonitoringPrefix + "spool/"
+	metrics := MetricSlice{
+		&Metric{name: prefix + "samples", reader: func() bitflow.Value {
+			return bitflow.Value(spool.Samples())
+		}},
+		&Metric{name: prefix + "bytes", reader: func() bitflow.Value {
+			return bitflow.Value(spool.Bytes())
+		}},
+		&Metric{name: prefix + "dropped", reader: func() bitflow.Value {
+			return bitflow.Value(spool.Dropped())
+		}},
+	}
+	metadata := MetricMetadataMap{
+		prefix + "samples": GaugeMetric(UnitCount, "Number of samples buffered on disk because the sink failed"),
+		prefix + "bytes":   GaugeMetric(UnitBytes, "Size of the spool files"),
+		prefix + "dropped": CounterMetric(UnitCount, "Number of spooled samples dropped because of the size or age limit"),
+	}
+	return metrics, metadata
+}
@@ -0,0 +1,169 @@
+package collector
+
+import (
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/antongulenko/golib"
+	"github.com/bitflow-stream/go-bitflow/bitflow"
+	"github.com/stretchr/testify/suite"
+)
+
+type SpoolTestSuite struct {
+	golib.AbstractTestSuite
+	dir    string
+	clock  *FakeClock
+	header *bitflow.Header
+}
+
+func TestSpool(t *testing.T) {
+	suite.Run(t, new(SpoolTestSuite))
+}
+
+func (suite *SpoolTestSuite) SetupTest() {
+	dir, err := ioutil.TempDir("", "bitflow-spool-test")
+	suite.NoError(err)
+	suite.dir = dir
+	suite.clock = NewFakeClock(time.Unix(1000, 0))
+	suite.header = &bitflow.Header{Fields: []string{"a", "b"}}
+}
+
+func (suite *SpoolTestSuite) TearDownTest() {
+	suite.NoError(os.RemoveAll(suite.dir))
+}
+
+func (suite *SpoolTestSuite) newSpool(maxBytes int64, maxAge time.Duration) *Spool {
+	spool, err := NewSpool(suite.dir, maxBytes, maxAge)
+	suite.NoError(err)
+	spool.Clock = suite.clock
+	return spool
+}
+
+func (suite *SpoolTestSuite) add(spool *Spool, header *bitflow.Header, values ...bitflow.Value) {
+	sample := &bitflow.Sample{Time: suite.clock.Now(), Values: values}
+	sample.SetTag("host", "test")
+	suite.NoError(spool.Add(sample, header))
+	suite.clock.Advance(time.Second)
+}
+
+type replayedSample struct {
+	sample *bitflow.Sample
+	header *bitflow.Header
+}
+
+func (suite *SpoolTestSuite) replay(spool *Spool) []replayedSample {
+	var res []replayedSample
+	_, err := spool.Replay(func(sample *bitflow.Sample, header *bitflow.Header) error {
+		res = append(res, replayedSample{sample, header})
+		return nil
+	})
+	suite.NoError(err)
+	return res
+}
+
+func (suite *SpoolTestSuite) TestReplayInOrder() {
+	spool := suite.newSpool(1024*1024, 0)
+	otherHeader := &bitflow.Header{Fields: []string{"c"}}
+	suite.add(spool, suite.header, 1, 2)
+	suite.add(spool, suite.header, 3, bitflow.Value(math.NaN()))
+	suite.add(spool, otherHeader, 5)
+	suite.add(spool, suite.header, 6, 7)
+	suite.Equal(4, spool.Samples())
+	suite.True(spool.Bytes() > 0)
+
+	replayed := suite.replay(spool)
+	suite.Len(replayed, 4)
+	suite.Equal([]bitflow.Value{1, 2}, replayed[0].sample.Values)
+	suite.Equal(bitflow.Value(3), replayed[1].sample.Values[0])
+	suite.True(math.IsNaN(float64(replayed[1].sample.Values[1])))
+	suite.Equal([]bitflow.Value{5}, replayed[2].sample.Values)
+	suite.Equal([]bitflow.Value{6, 7}, replayed[3].sample.Values)
+	suite.Equal(time.Unix(1000, 0).UnixNano(), replayed[0].sample.Time.UnixNano())
+	suite.Equal("test", replayed[0].sample.Tag("host"))
+	suite.Equal([]string{"a", "b"}, replayed[0].header.Fields)
+	suite.Equal([]string{"c"}, replayed[2].header.Fields)
+	suite.True(replayed[0].header == replayed[3].header, "equal headers should be shared")
+
+	suite.Equal(0, spool.Samples())
+	suite.Equal(int64(0), spool.Bytes())
+	suite.Equal(uint64(0), spool.Dropped())
+	files, err := ioutil.ReadDir(suite.dir)
+	suite.NoError(err)
+	suite.Empty(files)
+}
+
+func (suite *SpoolTestSuite) TestReplayFailure() {
+	spool := suite.newSpool(1024*1024, 0)
+	for i := 0; i < 5; i++ {
+		suite.add(spool, suite.header, bitflow.Value(i), 0)
+	}
+	var delivered []bitflow.Value
+	replayed, err := spool.Replay(func(sample *bitflow.Sample, header *bitflow.Header) error {
+		if len(delivered) == 2 {
+			return errors.New("sink failed")
+		}
+		delivered = append(delivered, sample.Values[0])
+		return nil
+	})
+	suite.Error(err)
+	suite.Equal(2, replayed)
+	suite.Equal(3, spool.Samples())
+
+	// New samples are appended after the remaining samples
+	suite.add(spool, suite.header, 5, 0)
+	for _, sample := range suite.replay(spool) {
+		delivered = append(delivered, sample.sample.Values[0])
+	}
+	suite.Equal([]bitflow.Value{0, 1, 2, 3, 4, 5}, delivered)
+}
+
+func (suite *SpoolTestSuite) TestSizeLimit() {
+	spool := suite.newSpool(2*minSpoolSegmentBytes, 0)
+	values := make([]bitflow.Value, 1000)
+	for i := 0; i < 40; i++ {
+		// Non-zero values, so that the encoded samples are large enough to fill multiple segments
+		for j := range values {
+			values[j] = bitflow.Value(i) + bitflow.Value(j)/7
+		}
+		suite.add(spool, &bitflow.Header{Fields: make([]string, len(values))}, values...)
+	}
+	suite.True(spool.Bytes() <= 2*minSpoolSegmentBytes, "spool too large")
+	suite.True(spool.Dropped() > 0)
+	suite.Equal(40, spool.Samples()+int(spool.Dropped()))
+
+	// The newest samples are kept
+	replayed := suite.replay(spool)
+	suite.Equal(bitflow.Value(39), replayed[len(replayed)-1].sample.Values[0])
+	suite.Equal(bitflow.Value(40-len(replayed)), replayed[0].sample.Values[0])
+}
+
+func (suite *SpoolTestSuite) TestAgeLimit() {
+	spool := suite.newSpool(1024*1024, 10*time.Second)
+	for i := 0; i < 15; i++ {
+		suite.add(spool, suite.header, bitflow.Value(i), 0)
+	}
+	// Now is 1015, so the samples from 1000 to 1004 are older than 10 seconds
+	replayed := suite.replay(spool)
+	suite.Len(replayed, 10)
+	suite.Equal(bitflow.Value(5), replayed[0].sample.Values[0])
+	suite.Equal(uint64(5), spool.Dropped())
+}
+
+func (suite *SpoolTestSuite) TestReload() {
+	spool := suite.newSpool(1024*1024, 0)
+	suite.add(spool, suite.header, 1, 2)
+	suite.add(spool, suite.header, 3, 4)
+
+	// A new process replays the samples left by the previous one
+	reloaded := suite.newSpool(1024*1024, 0)
+	suite.Equal(2, reloaded.Samples())
+	suite.add(reloaded, suite.header, 5, 6)
+	replayed := suite.replay(reloaded)
+	suite.Len(replayed, 3)
+	suite.Equal([]bitflow.Value{1, 2}, replayed[0].sample.Values)
+	suite.Equal([]bitflow.Value{5, 6}, replayed[2].sample.Values)
+}
@@ -0,0 +1,158 @@
+package collector
+
+import (
+	"sort"
+	"time"
+
+	"github.com/bitflow-stream/go-bitflow/bitflow"
+)
+
+// SelfMonitoringPrefix is prepended to the metrics describing the collectors themselves, see SampleSource.SelfMonitoring.
+const SelfMonitoringPrefix = "_collector/"
+
+type CollectorState string
+
+const (
+	CollectorActive   = CollectorState("active")
+	CollectorFiltered = CollectorState("filtered")
+	CollectorFailed   = CollectorState("failed")
+)
+
+// CollectorStatistics describes the state and the Update() behavior of one collector in the current collection round.
+type CollectorStatistics struct {
+	Name                string         `json:"name"`
+	State               CollectorState `json:"state"`
+	Updates             uint64         `json:"updates"`
+	Failures            uint64         `json:"failures"`
+	ConsecutiveFailures int            `json:"consecutive_failures"`
+	LastUpdate          time.Time      `json:"last_update"`
+	LastUpdateMillis    float64        `json:"last_update_ms"`
+	UpdateFrequency     string         `json:"update_frequency,omitempty"`
+	CounterResets       uint64         `json:"counter_resets,omitempty"`
+	RetryPolicy         RetryPolicy    `json:"retry_policy"`
+	Retry               *RetryState    `json:"retry,omitempty"`
+}
+
+// recordUpdate stores the start time, duration and result of one Update() call.
+func (node *collectorNode) recordUpdate(start time.Time, duration time.Duration, failed bool) {
+	node.statsLock.Lock()
+	defer node.statsLock.Unlock()
+	node.updates++
+	node.lastUpdate = start
+	node.lastUpdateDuration = duration
+	node.lastUpdateFailed = failed
+	if failed {
+		node.totalFailures++
+	} else {
+		node.lastMeasurement = start.Add(duration)
+	}
+}
+
+func (node *collectorNode) statistics(state CollectorState) CollectorStatistics {
+	node.statsLock.Lock()
+	defer node.statsLock.Unlock()
+	stats := CollectorStatistics{
+		Name:                node.String(),
+		State:               state,
+		Updates:             node.updates,
+		Failures:            node.totalFailures,
+		RetryPolicy:         node.retryPolicy,
+		ConsecutiveFailures: node.failedUpdates,
+		LastUpdate:          node.lastUpdate,
+		LastUpdateMillis:    float64(node.lastUpdateDuration) / float64(time.Millisecond),
+	}
+	if node.UpdateFrequency > 0 {
+		stats.UpdateFrequency = node.UpdateFrequency.String()
+	}
+	stats.CounterResets = node.counterResets()
+	if state == CollectorFailed {
+		retry := node.retry
+		stats.Retry = &retry
+	}
+	return stats
+}
+
+// counterResets returns the number of counter resets detected in the ValueRings of the node, see CounterValue.
+func (node *collectorNode) counterResets() (res uint64) {
+	for _, ring := range node.rings {
+		res += ring.Resets()
+	}
+	return
+}
+
+func (g *collectorGraph) nodeState(node *collectorNode) (CollectorState, bool) {
+	g.modificationLock.Lock()
+	defer g.modificationLock.Unlock()
+	switch {
+	case g.nodes[node]:
+		return CollectorActive, true
+	case g.failed[node]:
+		return CollectorFailed, true
+	case g.filtered[node]:
+		return CollectorFiltered, true
+	}
+	return "", false
+}
+
+// statistics returns the statistics of all active, failed and filtered collectors, sorted by name.
+// Collectors that have been disabled or pruned due to failed dependencies are omitted.
+func (g *collectorGraph) statistics() []CollectorStatistics {
+	res := make([]CollectorStatistics, 0, len(g.collectors))
+	for _, node := range g.collectors {
+		if state, ok := g.nodeState(node); ok {
+			res = append(res, node.statistics(state))
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+// getSelfMonitoringMetrics creates metrics exposing the statistics of all collectors in the graph.
+func (g *collectorGraph) getSelfMonitoringMetrics() (MetricSlice, MetricMetadataMap) {
+	var metrics MetricSlice
+	metadata := make(MetricMetadataMap)
+	add := func(name string, meta MetricMetadata, reader MetricReader) {
+		metrics = append(metrics, &Metric{name: name, reader: reader})
+		metadata[name] = meta
+	}
+	for _, node := range g.collectors {
+		if _, ok := g.nodeState(node); !ok {
+			continue
+		}
+		node := node
+		prefix := SelfMonitoringPrefix + node.String() + "/"
+		stateFlag := func(expected CollectorState) MetricReader {
+			return func() bitflow.Value {
+				if state, _ := g.nodeState(node); state == expected {
+					return 1
+				}
+				return 0
+			}
+		}
+		add(prefix+"update_ms", GaugeMetric(UnitMillis, "Duration of the most recent Update() call"), func() bitflow.Value {
+			node.statsLock.Lock()
+			defer node.statsLock.Unlock()
+			return bitflow.Value(node.lastUpdateDuration) / bitflow.Value(time.Millisecond)
+		})
+		add(prefix+"updates", CounterMetric(UnitCount, "Number of Update() calls"), func() bitflow.Value {
+			node.statsLock.Lock()
+			defer node.statsLock.Unlock()
+			return bitflow.Value(node.updates)
+		})
+		add(prefix+"failures", GaugeMetric(UnitCount, "Number of consecutive failed Update() calls"), func() bitflow.Value {
+			node.statsLock.Lock()
+			defer node.statsLock.Unlock()
+			return bitflow.Value(node.failedUpdates)
+		})
+		add(prefix+"failed", GaugeMetric("", "1 if the collector has failed, 0 otherwise"), stateFlag(CollectorFailed))
+		if len(node.rings) > 0 {
+			add(prefix+"counter_resets", CounterMetric(UnitCount, "Number of detected counter resets"), func() bitflow.Value {
+				return bitflow.Value(node.counterResets())
+			})
+		}
+		add(prefix+"filtered", GaugeMetric("", "1 if all metrics of the collector are filtered, 0 otherwise"), stateFlag(CollectorFiltered))
+	}
+	return metrics, metadata
+}
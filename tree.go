@@ -0,0 +1,104 @@
+package collector
+
+import (
+	"sort"
+
+	"github.com/antongulenko/golib"
+	"github.com/bitflow-stream/go-bitflow/bitflow"
+)
+
+// CollectorTree initializes a tree of collectors like the SampleSource, but updates the collectors synchronously
+// in explicit rounds, without background goroutines. It is intended for testing collectors, see the collectortest package.
+// Failed collectors are not checked for recovery.
+type CollectorTree struct {
+	base    *collectorGraph
+	graph   *collectorGraph
+	clock   Clock
+	stopper golib.StopChan
+}
+
+// NewCollectorTree initializes the given root collectors and all their sub-collectors. The clock is used for
+// update timeouts and statistics, and defaults to RealClock.
+func NewCollectorTree(clock Clock, roots ...Collector) (*CollectorTree, error) {
+	graph, err := initCollectorGraph(roots)
+	if err != nil {
+		return nil, err
+	}
+	tree := &CollectorTree{base: graph, clock: clockOrDefault(clock)}
+	tree.startRound()
+	return tree, nil
+}
+
+func (tree *CollectorTree) startRound() {
+	tree.graph = tree.base.clone()
+	tree.graph.clock = tree.clock
+	tree.graph.pruneAndRepair()
+	tree.stopper = golib.NewStopChan()
+}
+
+// Update calls Update() on all active collectors, dependencies first. It returns false if the update was aborted
+// because a collector reported MetricsChanged, see Changed() and Restart().
+func (tree *CollectorTree) Update() bool {
+	if tree.stopper.Stopped() {
+		return false
+	}
+	for _, node := range sortGraph(tree.graph) {
+		if !tree.graph.nodes[node] {
+			// Deleted, because a dependency has failed during this round
+			continue
+		}
+		node.update(tree.stopper)
+		if tree.stopper.Stopped() {
+			return false
+		}
+	}
+	return true
+}
+
+// Restart initializes the collectors that reported MetricsChanged again, like the SampleSource does
+// when restarting the metric collection.
+func (tree *CollectorTree) Restart() error {
+	if err := tree.base.reinitNodes(tree.graph.changedNodes()); err != nil {
+		return err
+	}
+	tree.startRound()
+	return nil
+}
+
+// Metrics reads the current values of all metrics of the active collectors.
+func (tree *CollectorTree) Metrics() map[string]bitflow.Value {
+	res := make(map[string]bitflow.Value)
+	for _, metric := range tree.graph.getMetrics() {
+		res[metric.name] = metric.reader()
+	}
+	return res
+}
+
+// Metadata returns the metadata of the metrics of all active collectors.
+func (tree *CollectorTree) Metadata() MetricMetadataMap {
+	return tree.graph.getMetadata()
+}
+
+// Failed returns the sorted names of the collectors that have failed during Init() or Update().
+func (tree *CollectorTree) Failed() []string {
+	return sortedNodeNames(tree.graph.failedList)
+}
+
+// Changed returns the sorted names of the collectors that have reported MetricsChanged since the last Restart().
+func (tree *CollectorTree) Changed() []string {
+	return sortedNodeNames(tree.graph.changedNodes())
+}
+
+// Statistics returns the state and update statistics of all collectors.
+func (tree *CollectorTree) Statistics() []CollectorStatistics {
+	return tree.graph.statistics()
+}
+
+func sortedNodeNames(nodes []*collectorNode) []string {
+	res := make([]string, len(nodes))
+	for i, node := range nodes {
+		res[i] = node.String()
+	}
+	sort.Strings(res)
+	return res
+}
@@ -2,6 +2,7 @@ package collector
 
 import (
 	"fmt"
+	"math"
 	"sync"
 	"time"
 
@@ -9,25 +10,56 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// ValueRingFactory creates ValueRings with a common configuration. When Length is changed through SetLength(),
+// the rings created by the factory adopt the new length the next time a value is added, keeping the newest values.
 type ValueRingFactory struct {
 	Length   int
 	Interval time.Duration
+
+	// Clock provides the timestamps of the stored values. Defaults to RealClock.
+	Clock Clock
+
+	// Protects Length, which is read by rings that are concurrently updated
+	lengthLock sync.Mutex
+}
+
+// SetLength changes the Length of the factory and of all rings created by it, see ValueRingFactory.
+func (factory *ValueRingFactory) SetLength(length int) {
+	factory.lengthLock.Lock()
+	defer factory.lengthLock.Unlock()
+	factory.Length = length
+}
+
+func (factory *ValueRingFactory) getLength() int {
+	factory.lengthLock.Lock()
+	defer factory.lengthLock.Unlock()
+	return factory.Length
 }
 
 func (factory *ValueRingFactory) NewValueRing() *ValueRing {
 	return &ValueRing{
-		values:   make([]TimedValue, factory.Length),
+		values:   make([]TimedValue, factory.getLength()),
 		interval: factory.Interval,
+		clock:    factory.GetClock(),
+		factory:  factory,
 	}
 }
 
+// GetClock returns the configured Clock, or RealClock
+func (factory *ValueRingFactory) GetClock() Clock {
+	return clockOrDefault(factory.Clock)
+}
+
 type ValueRing struct {
 	interval time.Duration
+	clock    Clock
 	values   []TimedValue
 	head     int // actually head+1
+	factory  *ValueRingFactory
 
-	aggregator   LogbackValue
-	previousDiff bitflow.Value
+	aggregator LogbackValue
+	resets     uint64
+	updates    uint64 // Number of FlushHead() calls, used to cache values computed from the ring
 
 	// Serializes GetDiff()/GetHead() and FlushHead()
 	// Writing access must be serialized externally!
@@ -39,6 +71,20 @@ type LogbackValue interface {
 	AddValue(val LogbackValue) LogbackValue
 }
 
+// CounterValue can be implemented by LogbackValues of monotonically increasing integer counters. When a counter decreases,
+// the ValueRing uses the counter width and the rate before the decrease to decide whether the counter has wrapped around
+// or has been reset (e.g. after a process restart or VM reboot). After a wrap-around, DiffValue() must return the correct rate,
+// i.e. compute the difference modulo 2^CounterWidth(). After a reset, the older values are discarded and the reset is counted.
+type CounterValue interface {
+	LogbackValue
+
+	// CounterWidth returns the number of bits of the counter, or 0 if the counter never wraps around.
+	CounterWidth() uint
+
+	// CounterValue returns the current value of the counter.
+	CounterValue() uint64
+}
+
 type TimedValue struct {
 	time.Time // Timestamp of recording
 	val       LogbackValue
@@ -64,13 +110,19 @@ func (ring *ValueRing) FlushHead() {
 	ring.lock.Lock()
 	defer ring.lock.Unlock()
 
-	ring.values[ring.head] = TimedValue{time.Now(), ring.aggregator}
+	if ring.factory != nil {
+		if length := ring.factory.getLength(); length > 0 && length != len(ring.values) {
+			ring.resize(length)
+		}
+	}
+	ring.values[ring.head] = TimedValue{ring.clock.Now(), ring.aggregator}
 	if ring.head >= len(ring.values)-1 {
 		ring.head = 0
 	} else {
 		ring.head++
 	}
 	ring.aggregator = nil
+	ring.updates++
 }
 
 func (ring *ValueRing) Add(val LogbackValue) {
@@ -98,15 +150,121 @@ func (ring *ValueRing) GetDiff() bitflow.Value {
 	ring.lock.Lock()
 	defer ring.lock.Unlock()
 
-	val := ring.getDiffInterval(ring.interval)
-	if val < 0 {
-		// Likely means a number has overflown. Temporarily stick to same value.
-		val = ring.previousDiff
-		ring.flush(ring.head - 2) // Only keep the latest sample
-	} else {
-		ring.previousDiff = val
+	return ring.getDiffInterval(ring.interval)
+}
+
+// GetDiffWindow returns the rate over the given time window, instead of the Interval configured in the ValueRingFactory.
+// The ring must be long enough to contain the values for the entire window, otherwise the rate over a shorter time is returned.
+func (ring *ValueRing) GetDiffWindow(window time.Duration) bitflow.Value {
+	ring.lock.Lock()
+	defer ring.lock.Unlock()
+	return ring.getDiffInterval(window)
+}
+
+func (ring *ValueRing) getUpdates() uint64 {
+	ring.lock.Lock()
+	defer ring.lock.Unlock()
+	return ring.updates
+}
+
+// Resets returns the number of detected counter resets, see CounterValue.
+func (ring *ValueRing) Resets() uint64 {
+	ring.lock.Lock()
+	defer ring.lock.Unlock()
+	return ring.resets
+}
+
+// RateStats contains statistics about the rates between consecutive values in a ValueRing
+type RateStats struct {
+	Min    bitflow.Value
+	Max    bitflow.Value
+	Stddev bitflow.Value
+}
+
+// GetRateStats computes the minimum, maximum and standard deviation of the rates between every two consecutive
+// values within the given time window.
+func (ring *ValueRing) GetRateStats(window time.Duration) RateStats {
+	ring.lock.Lock()
+	defer ring.lock.Unlock()
+
+	var values []TimedValue // Newest to oldest
+	start := ring.getHead().Time.Add(-window)
+	ring.walk(func(value TimedValue) bool {
+		if value.Time.Before(start) {
+			return false
+		}
+		values = append(values, value)
+		return true
+	})
+	return rateStats(values)
+}
+
+// WindowStats contains the rate over a time window, and the statistics of the rates within the window.
+// Reset is true if a counter reset happened within the window, in which case the Rate only covers the values after the reset.
+type WindowStats struct {
+	Rate  bitflow.Value
+	Reset bool
+	RateStats
+}
+
+// GetWindowStats returns the results of GetDiffWindow() and GetRateStats() for the given window,
+// but walks the stored values only once. The RateStats are only computed if statistics is true.
+// Unlike GetDiff() and GetDiffWindow(), detected counter resets do not modify the ring, so reading the statistics of one window
+// never affects the results of other windows.
+func (ring *ValueRing) GetWindowStats(window time.Duration, statistics bool) (stats WindowStats) {
+	ring.lock.Lock()
+	defer ring.lock.Unlock()
+
+	head := ring.getHead()
+	if head.val == nil {
+		return
 	}
-	return val
+	// Newest to oldest: the values within the window, followed by the value the rate is computed from (see get()),
+	// followed by the values up to the reference value for checking counter wrap-arounds (see getDiffInterval())
+	var values []TimedValue
+	start := head.Time.Add(-window)
+	previous := -1
+	ring.walk(func(value TimedValue) bool {
+		values = append(values, value)
+		if previous < 0 {
+			if value.Time.Before(start) {
+				previous = len(values) - 1
+			}
+			return true
+		}
+		return !value.Time.Before(values[previous].Time.Add(-window))
+	})
+	inWindow := previous
+	if previous < 0 {
+		// All values are within the window, the rate is computed from the oldest value
+		previous = len(values) - 1
+		inWindow = len(values)
+	}
+	expected := float64(unknownRate)
+	if reference := len(values) - 1; reference > previous {
+		expected = counterRate(values[previous], values[reference])
+	}
+	if statistics {
+		stats.RateStats = rateStats(values[:inWindow])
+	}
+
+	// Compute the rate from the oldest value after the newest counter reset
+	from := previous
+	pairExpected := expected
+	for i := previous; i > 0; i-- {
+		if _, reset := rate(values[i-1], values[i], pairExpected); reset {
+			from = i - 1
+			expected = unknownRate
+			pairExpected = unknownRate
+			stats.Reset = true
+			continue
+		}
+		pairExpected = counterRate(values[i-1], values[i])
+	}
+	val, reset := rate(head, values[from], expected)
+	stats.Reset = stats.Reset || reset
+	stats.Rate = val
+	return
 }
 
 // May return nil in case of an empty ring
@@ -129,11 +287,128 @@ func (ring *ValueRing) getDiffInterval(before time.Duration) bitflow.Value {
 	if previous.val == nil {
 		return bitflow.Value(0)
 	}
-	interval := head.Time.Sub(previous.Time)
-	if interval == 0 {
-		return bitflow.Value(0)
+	expected := float64(unknownRate)
+	if reference := ring.get(previous.Time.Add(-before)); reference.val != nil && reference.Time.Before(previous.Time) {
+		expected = counterRate(previous, reference)
+	}
+	val, reset := rate(head, previous, expected)
+	if reset {
+		ring.counterReset(previous, head)
+	}
+	return val
+}
+
+func (ring *ValueRing) counterReset(previous, head TimedValue) {
+	// Values before the reset are not comparable to the current value
+	ring.resets++
+	ring.flush(ring.head - 2) // Only keep the latest sample
+	log.Debugf("Counter reset detected (%v -> %v), discarding older values", previous, head)
+}
+
+// rateStats computes the RateStats of the given values, ordered from newest to oldest
+func rateStats(values []TimedValue) RateStats {
+	var rates []float64
+	expected := float64(unknownRate)
+	for i := len(values) - 1; i > 0; i-- {
+		// The rate between the previous pair of values is used to check the plausibility of counter wrap-arounds
+		rate, reset := rate(values[i-1], values[i], expected)
+		if reset {
+			// Values before a counter reset are not comparable. They are flushed by the next GetDiff().
+			rates = rates[:0]
+			expected = unknownRate
+			continue
+		}
+		rates = append(rates, float64(rate))
+		expected = counterRate(values[i-1], values[i])
+	}
+	if len(rates) == 0 {
+		return RateStats{}
+	}
+	min, max, sum := rates[0], rates[0], 0.0
+	for _, rate := range rates {
+		min = math.Min(min, rate)
+		max = math.Max(max, rate)
+		sum += rate
+	}
+	mean := sum / float64(len(rates))
+	variance := 0.0
+	for _, rate := range rates {
+		variance += (rate - mean) * (rate - mean)
+	}
+	variance /= float64(len(rates))
+	return RateStats{Min: bitflow.Value(min), Max: bitflow.Value(max), Stddev: bitflow.Value(math.Sqrt(variance))}
+}
+
+// unknownRate is passed to rate() if the rate of the counter before the compared values is not known
+const unknownRate = -1
+
+// maxWrapRateFactor limits the rate after a counter wrap-around, relative to the rate before the wrap-around.
+// A decrease of the counter that would result in a higher rate is treated as a reset.
+const maxWrapRateFactor = 10
+
+// rate computes the rate between the two values, and returns true if a counter reset happened in between.
+// The expected rate is the rate of the counter (in counter units per second) before the older value, or unknownRate.
+func rate(newer, older TimedValue, expected float64) (bitflow.Value, bool) {
+	interval := newer.Time.Sub(older.Time)
+	if interval <= 0 {
+		return bitflow.Value(0), false
+	}
+	if newCounter, ok := newer.val.(CounterValue); ok {
+		if oldCounter, ok := older.val.(CounterValue); ok {
+			maxDelta := float64(unknownRate)
+			if expected >= 0 {
+				maxDelta = expected * interval.Seconds() * maxWrapRateFactor
+			}
+			if isCounterReset(oldCounter.CounterValue(), newCounter.CounterValue(), newCounter.CounterWidth(), maxDelta) {
+				return bitflow.Value(0), true
+			}
+			return newer.val.DiffValue(older.val, interval), false
+		}
+	}
+	val := newer.val.DiffValue(older.val, interval)
+	if val < 0 {
+		// The value has decreased, which can only be handled like a reset for values with unknown width
+		return bitflow.Value(0), true
+	}
+	return val, false
+}
+
+// counterRate returns the rate of the counter between the two values in counter units per second,
+// or unknownRate if the values are not counters or the counter has decreased.
+func counterRate(newer, older TimedValue) float64 {
+	newCounter, ok := newer.val.(CounterValue)
+	if !ok {
+		return unknownRate
+	}
+	oldCounter, ok := older.val.(CounterValue)
+	interval := newer.Time.Sub(older.Time)
+	if !ok || interval <= 0 || newCounter.CounterValue() < oldCounter.CounterValue() {
+		return unknownRate
+	}
+	return float64(newCounter.CounterValue()-oldCounter.CounterValue()) / interval.Seconds()
+}
+
+// isCounterReset returns true if the counter has decreased from old to new, and the decrease cannot be explained
+// by the counter wrapping around. A wrap-around is only assumed if the wrapped difference is less than half the counter range,
+// and does not exceed maxDelta. If maxDelta is negative, because the previous rate of the counter is not known,
+// every decrease is treated as a reset: a false reset only loses one rate, while a false wrap-around results in a huge bogus rate.
+func isCounterReset(old, new uint64, width uint, maxDelta float64) bool {
+	if new >= old {
+		return false
+	}
+	if width == 0 || maxDelta < 0 {
+		return true
 	}
-	return head.val.DiffValue(previous.val, interval)
+	mask := counterMask(width)
+	wrapped := (new - old) & mask
+	return wrapped > mask/2 || float64(wrapped) > maxDelta
+}
+
+func counterMask(width uint) uint64 {
+	if width >= 64 {
+		return math.MaxUint64
+	}
+	return 1<<width - 1
 }
 
 func (ring *ValueRing) getHead() TimedValue {
@@ -146,6 +421,20 @@ func (ring *ValueRing) getHead() TimedValue {
 	return ring.values[headIndex]
 }
 
+// walk iterates the stored values from the newest to the oldest, until the callback returns false
+func (ring *ValueRing) walk(callback func(TimedValue) bool) {
+	for i := ring.head - 1; i >= 0; i-- {
+		if ring.values[i].val == nil || !callback(ring.values[i]) {
+			return
+		}
+	}
+	for i := len(ring.values) - 1; i >= ring.head; i-- {
+		if ring.values[i].val == nil || !callback(ring.values[i]) {
+			return
+		}
+	}
+}
+
 // Does not check for empty ring
 func (ring *ValueRing) get(before time.Time) (result TimedValue) {
 	walkRing := func(i int) bool {
@@ -172,20 +461,10 @@ func (ring *ValueRing) get(before time.Time) (result TimedValue) {
 }
 
 func (ring *ValueRing) flush(start int) {
-	// Flush all older values, starting (including) the start
-	if start < 0 {
-		start += len(ring.values)
-	}
-	for i := start; i >= 0; i-- {
-		if ring.values[i].val == nil {
-			return
-		}
-		ring.values[i].val = nil
-	}
-	for i := len(ring.values) - 1; i >= ring.head; i-- {
-		if ring.values[i].val == nil {
-			return
-		}
+	// Flush all older values, starting (including) the start, but never the newest value
+	length := len(ring.values)
+	newest := (ring.head - 1 + length) % length
+	for i := (start%length + length) % length; i != newest && ring.values[i].val != nil; i = (i - 1 + length) % length {
 		ring.values[i].val = nil
 	}
 }
@@ -215,3 +494,86 @@ func (val StoredValue) AddValue(incoming LogbackValue) LogbackValue {
 		return StoredValue(0)
 	}
 }
+
+// Counter32 is a 32 bit counter, that wraps around to zero after reaching math.MaxUint32.
+type Counter32 uint32
+
+func (val Counter32) CounterWidth() uint {
+	return 32
+}
+
+func (val Counter32) CounterValue() uint64 {
+	return uint64(val)
+}
+
+func (val Counter32) DiffValue(logback LogbackValue, interval time.Duration) bitflow.Value {
+	switch previous := logback.(type) {
+	case Counter32:
+		return bitflow.Value(val-previous) / bitflow.Value(interval.Seconds())
+	case *Counter32:
+		return bitflow.Value(val-*previous) / bitflow.Value(interval.Seconds())
+	default:
+		log.Errorf("Cannot diff %v (%T) and %v (%T)", val, val, logback, logback)
+		return bitflow.Value(0)
+	}
+}
+
+func (val Counter32) AddValue(incoming LogbackValue) LogbackValue {
+	// The sum wraps around at the same width, so differences of the sum remain correct
+	switch other := incoming.(type) {
+	case Counter32:
+		return Counter32(val + other)
+	case *Counter32:
+		return Counter32(val + *other)
+	default:
+		log.Errorf("Cannot add %v (%T) and %v (%T)", val, val, incoming, incoming)
+		return Counter32(0)
+	}
+}
+
+// Counter64 is a 64 bit counter, that wraps around to zero after reaching math.MaxUint64.
+type Counter64 uint64
+
+func (val Counter64) CounterWidth() uint {
+	return 64
+}
+
+func (val Counter64) CounterValue() uint64 {
+	return uint64(val)
+}
+
+func (val Counter64) DiffValue(logback LogbackValue, interval time.Duration) bitflow.Value {
+	switch previous := logback.(type) {
+	case Counter64:
+		return bitflow.Value(val-previous) / bitflow.Value(interval.Seconds())
+	case *Counter64:
+		return bitflow.Value(val-*previous) / bitflow.Value(interval.Seconds())
+	default:
+		log.Errorf("Cannot diff %v (%T) and %v (%T)", val, val, logback, logback)
+		return bitflow.Value(0)
+	}
+}
+
+func (val Counter64) AddValue(incoming LogbackValue) LogbackValue {
+	switch other := incoming.(type) {
+	case Counter64:
+		return Counter64(val + other)
+	case *Counter64:
+		return Counter64(val + *other)
+	default:
+		log.Errorf("Cannot add %v (%T) and %v (%T)", val, val, incoming, incoming)
+		return Counter64(0)
+	}
+}
+
+// resize changes the number of stored values, keeping the newest values
+func (ring *ValueRing) resize(length int) {
+	// Oldest to newest, including empty slots of a ring that is not full yet
+	ordered := append(append(make([]TimedValue, 0, len(ring.values)), ring.values[ring.head:]...), ring.values[:ring.head]...)
+	if len(ordered) > length {
+		ordered = ordered[len(ordered)-length:]
+	}
+	ring.values = make([]TimedValue, length)
+	copy(ring.values, ordered)
+	ring.head = len(ordered) % length
+}
@@ -1,20 +1,188 @@
 package collector
 
 import (
+	"math"
 	"testing"
+	"time"
 
 	"github.com/antongulenko/golib"
+	"github.com/bitflow-stream/go-bitflow/bitflow"
 	"github.com/stretchr/testify/suite"
 )
 
 type ValueRingTestSuite struct {
 	golib.AbstractTestSuite
+	clock *FakeClock
 }
 
 func TestValueRing(t *testing.T) {
 	suite.Run(t, new(ValueRingTestSuite))
 }
 
+func (suite *ValueRingTestSuite) SetupTest() {
+	suite.clock = NewFakeClock(time.Unix(1000, 0))
+}
+
+func (suite *ValueRingTestSuite) newRing(length int) *ValueRing {
+	factory := ValueRingFactory{Length: length, Interval: time.Second, Clock: suite.clock}
+	return factory.NewValueRing()
+}
+
+// fill adds one value per second to the ring
+func (suite *ValueRingTestSuite) fill(ring *ValueRing, values ...LogbackValue) {
+	for _, val := range values {
+		suite.clock.Advance(time.Second)
+		ring.Add(val)
+	}
+}
+
 func (suite *ValueRingTestSuite) TestRing() {
-	// TODO write tests
+	ring := suite.newRing(10)
+	suite.Equal(bitflow.Value(0), ring.GetDiff(), "empty ring")
+	suite.Nil(ring.GetHead())
+
+	suite.fill(ring, StoredValue(10))
+	suite.Equal(bitflow.Value(0), ring.GetDiff(), "single value")
+
+	// The head is compared to the newest value that is older than the interval
+	suite.fill(ring, StoredValue(20), StoredValue(40))
+	suite.Equal(bitflow.Value(15), ring.GetDiff())
+	suite.Equal(StoredValue(40), ring.GetHead())
+
+	suite.clock.Advance(500 * time.Millisecond)
+	ring.Add(StoredValue(50))
+	suite.Equal(bitflow.Value(30/1.5), ring.GetDiff())
+}
+
+func (suite *ValueRingTestSuite) TestOverwriteOldValues() {
+	ring := suite.newRing(3)
+	suite.fill(ring, StoredValue(0), StoredValue(100), StoredValue(110), StoredValue(120), StoredValue(130))
+	suite.Equal(bitflow.Value(10), ring.GetDiff())
+	// Only 3 values are kept, so the window is shortened
+	suite.Equal(bitflow.Value(10), ring.GetDiffWindow(time.Minute))
+}
+
+func (suite *ValueRingTestSuite) TestResize() {
+	factory := ValueRingFactory{Length: 3, Interval: time.Second, Clock: suite.clock}
+	ring := factory.NewValueRing()
+	suite.fill(ring, StoredValue(0), StoredValue(10), StoredValue(20), StoredValue(30))
+
+	// The newest values are kept when the ring grows
+	factory.SetLength(6)
+	suite.fill(ring, StoredValue(40))
+	suite.Len(ring.values, 6)
+	suite.Equal(bitflow.Value(10), ring.GetDiffWindow(3*time.Second))
+	suite.fill(ring, StoredValue(50), StoredValue(60))
+	suite.Equal(bitflow.Value(10), ring.GetDiffWindow(5*time.Second))
+
+	// The oldest values are dropped when the ring shrinks
+	factory.SetLength(2)
+	suite.fill(ring, StoredValue(70))
+	suite.Len(ring.values, 2)
+	suite.Equal(StoredValue(70), ring.GetHead())
+	suite.Equal(bitflow.Value(10), ring.GetDiffWindow(5*time.Second), "only the previous value is left")
+}
+
+func (suite *ValueRingTestSuite) TestAggregateHead() {
+	ring := suite.newRing(10)
+	for i := 1; i <= 3; i++ {
+		suite.clock.Advance(time.Second)
+		ring.AddValueToHead(bitflow.Value(i))
+		ring.AddValueToHead(bitflow.Value(i * 10))
+		ring.FlushHead()
+	}
+	suite.Equal(bitflow.Value(11), ring.GetDiff())
+	suite.Equal(StoredValue(33), ring.GetHead())
+
+	suite.clock.Advance(time.Second)
+	ring.IncrementValue(5)
+	suite.Equal(StoredValue(38), ring.GetHead())
+	suite.Equal(bitflow.Value(8), ring.GetDiff())
+}
+
+func (suite *ValueRingTestSuite) TestWindows() {
+	ring := suite.newRing(20)
+	suite.fill(ring, StoredValue(0), StoredValue(1), StoredValue(3), StoredValue(6), StoredValue(10), StoredValue(15))
+	suite.Equal(bitflow.Value(4.5), ring.GetDiff())
+	suite.Equal(bitflow.Value(4), ring.GetDiffWindow(2*time.Second))
+	suite.Equal(bitflow.Value(3), ring.GetDiffWindow(5*time.Second))
+	suite.Equal(bitflow.Value(3), ring.GetDiffWindow(time.Hour))
+
+	stats := ring.GetRateStats(3 * time.Second)
+	suite.Equal(bitflow.Value(3), stats.Min)
+	suite.Equal(bitflow.Value(5), stats.Max)
+	suite.InDelta(math.Sqrt(2.0/3.0), float64(stats.Stddev), 0.0001)
+
+	suite.Equal(RateStats{}, suite.newRing(5).GetRateStats(time.Minute))
+}
+
+func (suite *ValueRingTestSuite) TestCounterWrap() {
+	ring := suite.newRing(10)
+	suite.fill(ring, Counter32(math.MaxUint32-49), Counter32(math.MaxUint32-29), Counter32(math.MaxUint32-9), Counter32(10))
+	suite.Equal(bitflow.Value(20), ring.GetDiff())
+	suite.Equal(uint64(0), ring.Resets())
+	suite.Equal(RateStats{Min: 20, Max: 20}, ring.GetRateStats(time.Minute))
+}
+
+func (suite *ValueRingTestSuite) TestImplausibleCounterWrap() {
+	// The counter was reset at a high value: a wrap-around would result in a rate of ~2^31 per second
+	ring := suite.newRing(10)
+	suite.fill(ring, Counter32(math.MaxUint32/2+1000), Counter32(math.MaxUint32/2+2000), Counter32(math.MaxUint32/2+3000), Counter32(10))
+	suite.Equal(bitflow.Value(0), ring.GetDiff())
+	suite.Equal(uint64(1), ring.Resets())
+
+	// Without a previous rate, a decrease is treated as a reset
+	ring = suite.newRing(10)
+	suite.fill(ring, Counter32(math.MaxUint32-9), Counter32(10))
+	suite.Equal(bitflow.Value(0), ring.GetDiff())
+	suite.Equal(uint64(1), ring.Resets())
+}
+
+func (suite *ValueRingTestSuite) TestCounterReset() {
+	ring := suite.newRing(10)
+	suite.fill(ring, Counter64(1000), Counter64(2000), Counter64(5))
+	suite.Equal(bitflow.Value(0), ring.GetDiff())
+	suite.Equal(uint64(1), ring.Resets())
+
+	// The values before the reset have been discarded
+	suite.fill(ring, Counter64(25))
+	suite.Equal(bitflow.Value(20), ring.GetDiff())
+	suite.Equal(bitflow.Value(20), ring.GetDiffWindow(time.Minute))
+	suite.Equal(uint64(1), ring.Resets())
+
+	// Values without a counter width are reset whenever they decrease
+	ring = suite.newRing(10)
+	suite.fill(ring, StoredValue(10), StoredValue(5))
+	suite.Equal(bitflow.Value(0), ring.GetDiff())
+	suite.Equal(uint64(1), ring.Resets())
+}
+
+func (suite *ValueRingTestSuite) TestCounterResetAfterWrap() {
+	// The reset value is stored at the last index (head == 0) and at the first index (head == 1) of the ring
+	for _, values := range [][]LogbackValue{
+		{Counter64(1000), Counter64(2000), Counter64(5)},
+		{Counter64(1000), Counter64(2000), Counter64(3000), Counter64(5)},
+	} {
+		ring := suite.newRing(3)
+		suite.fill(ring, values...)
+		suite.Equal(bitflow.Value(0), ring.GetDiff())
+		suite.Equal(uint64(1), ring.Resets())
+		suite.Equal(Counter64(5), ring.GetHead(), "the latest value must be kept")
+
+		suite.fill(ring, Counter64(25))
+		suite.Equal(bitflow.Value(20), ring.GetDiff())
+		suite.Equal(bitflow.Value(20), ring.GetDiffWindow(time.Minute))
+		suite.Equal(uint64(1), ring.Resets())
+	}
+}
+
+func (suite *ValueRingTestSuite) TestIsCounterReset() {
+	suite.False(isCounterReset(10, 20, 32, unknownRate))
+	suite.False(isCounterReset(math.MaxUint32-10, 10, 32, 100))
+	suite.True(isCounterReset(math.MaxUint32-10, 10, 32, 10), "wrapped delta larger than expected")
+	suite.True(isCounterReset(math.MaxUint32-10, 10, 32, unknownRate))
+	suite.True(isCounterReset(1000, 10, 32, math.MaxUint32))
+	suite.True(isCounterReset(1000, 10, 64, math.MaxUint64))
+	suite.False(isCounterReset(math.MaxUint64-10, 10, 64, 100))
+	suite.True(isCounterReset(11, 10, 0, 100))
 }
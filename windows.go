@@ -0,0 +1,153 @@
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bitflow-stream/go-bitflow/bitflow"
+)
+
+// MetricRingMap maps metric names to the ValueRings their values are computed from
+type MetricRingMap map[string]*ValueRing
+
+// WindowedCollector is implemented by collectors whose metrics are rates computed through ValueRings.
+// The rings are used to derive rates over additional time windows, see SampleSource.MetricWindows.
+type WindowedCollector interface {
+	MetricRings() MetricRingMap
+}
+
+// MetricWindows configures additional metrics for a rate metric: the rate over each of the given time windows,
+// named <metric>/<window>, and optionally the minimum, maximum and standard deviation of the rates between
+// the individual values within each window, named <metric>/<window>/min etc.
+type MetricWindows struct {
+	Windows    []time.Duration
+	Statistics bool
+}
+
+// MaxMetricWindow returns the longest configured window. The ValueRingFactory.Length must be large enough
+// to keep the values of that time window.
+func MaxMetricWindow(windows map[*regexp.Regexp]MetricWindows) (max time.Duration) {
+	for _, config := range windows {
+		for _, window := range config.Windows {
+			if window > max {
+				max = window
+			}
+		}
+	}
+	return
+}
+
+func (g *collectorGraph) getWindowedMetrics(windowConfig map[*regexp.Regexp]MetricWindows) (MetricSlice, MetricMetadataMap) {
+	return getWindowedMetrics(g.nodes, windowConfig)
+}
+
+func getWindowedMetrics(nodes map[*collectorNode]bool, windowConfig map[*regexp.Regexp]MetricWindows) (MetricSlice, MetricMetadataMap) {
+	var metrics MetricSlice
+	metadata := make(MetricMetadataMap)
+	if len(windowConfig) == 0 {
+		return metrics, metadata
+	}
+	for node := range nodes {
+		for name := range node.metrics {
+			ring, ok := node.rings[name]
+			if !ok {
+				continue
+			}
+			windows, statistics := matchMetricWindows(windowConfig, name)
+			baseMeta, hasMeta := node.metadata[name]
+			for _, window := range windows {
+				reader := &windowReader{ring: ring, window: window, statistics: statistics}
+				windowName := name + "/" + formatWindow(window)
+				metrics = append(metrics, &Metric{name: windowName, reader: func() bitflow.Value {
+					return reader.get().Rate
+				}, entity: node.entity, node: node})
+				if hasMeta {
+					meta := baseMeta
+					meta.Description += " (over " + formatWindow(window) + ")"
+					metadata[windowName] = meta
+				}
+				if !statistics {
+					continue
+				}
+				for _, stat := range []struct {
+					name        string
+					description string
+					read        func(WindowStats) bitflow.Value
+				}{
+					{"min", "Minimum", func(stats WindowStats) bitflow.Value { return stats.Min }},
+					{"max", "Maximum", func(stats WindowStats) bitflow.Value { return stats.Max }},
+					{"stddev", "Standard deviation", func(stats WindowStats) bitflow.Value { return stats.Stddev }},
+				} {
+					read := stat.read
+					statName := windowName + "/" + stat.name
+					metrics = append(metrics, &Metric{name: statName, reader: func() bitflow.Value {
+						return read(reader.get())
+					}, entity: node.entity, node: node})
+					meta := RateMetric(baseMeta.Unit, stat.description+" of the rates of "+name+" within "+formatWindow(window))
+					metadata[statName] = meta
+				}
+			}
+		}
+	}
+	return metrics, metadata
+}
+
+// windowReader shares the WindowStats of one time window between the metrics of that window.
+// The stats are computed in one pass over the ring, and only again after new values have been added to the ring.
+type windowReader struct {
+	ring       *ValueRing
+	window     time.Duration
+	statistics bool
+
+	lock    sync.Mutex
+	valid   bool
+	updates uint64
+	stats   WindowStats
+}
+
+func (reader *windowReader) get() WindowStats {
+	reader.lock.Lock()
+	defer reader.lock.Unlock()
+	updates := reader.ring.getUpdates()
+	if !reader.valid || updates != reader.updates {
+		reader.stats = reader.ring.GetWindowStats(reader.window, reader.statistics)
+		reader.updates = updates
+		reader.valid = true
+	}
+	return reader.stats
+}
+
+func matchMetricWindows(windowConfig map[*regexp.Regexp]MetricWindows, metric string) (windows []time.Duration, statistics bool) {
+	unique := make(map[time.Duration]bool)
+	for regex, config := range windowConfig {
+		if regex.MatchString(metric) {
+			for _, window := range config.Windows {
+				if window > 0 && !unique[window] {
+					unique[window] = true
+					windows = append(windows, window)
+				}
+			}
+			statistics = statistics || config.Statistics
+		}
+	}
+	sort.Slice(windows, func(i, j int) bool {
+		return windows[i] < windows[j]
+	})
+	return
+}
+
+func formatWindow(window time.Duration) string {
+	switch {
+	case window%time.Hour == 0:
+		return fmt.Sprintf("%dh", window/time.Hour)
+	case window%time.Minute == 0:
+		return fmt.Sprintf("%dm", window/time.Minute)
+	case window%time.Second == 0:
+		return fmt.Sprintf("%ds", window/time.Second)
+	default:
+		return fmt.Sprintf("%dms", window/time.Millisecond)
+	}
+}
@@ -0,0 +1,147 @@
+package collector
+
+import (
+	"math"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/antongulenko/golib"
+	"github.com/bitflow-stream/go-bitflow/bitflow"
+	"github.com/stretchr/testify/suite"
+)
+
+type WindowsTestSuite struct {
+	golib.AbstractTestSuite
+	clock *FakeClock
+	ring  *ValueRing
+	node  *collectorNode
+}
+
+func TestWindows(t *testing.T) {
+	suite.Run(t, new(WindowsTestSuite))
+}
+
+func (suite *WindowsTestSuite) SetupTest() {
+	suite.clock = NewFakeClock(time.Unix(1000, 0))
+	factory := ValueRingFactory{Length: 20, Interval: time.Second, Clock: suite.clock}
+	suite.ring = factory.NewValueRing()
+	suite.node = &collectorNode{
+		metrics: MetricReaderMap{
+			"net-io/bytes": suite.ring.GetDiff,
+			"cpu":          func() bitflow.Value { return 1 },
+		},
+		metadata: MetricMetadataMap{"net-io/bytes": RateMetric("B/s", "Received bytes")},
+		rings:    MetricRingMap{"net-io/bytes": suite.ring},
+	}
+}
+
+// fill adds one value per second to the ring
+func (suite *WindowsTestSuite) fill(values ...LogbackValue) {
+	for _, val := range values {
+		suite.clock.Advance(time.Second)
+		suite.ring.Add(val)
+	}
+}
+
+func (suite *WindowsTestSuite) read(metrics MetricSlice) map[string]bitflow.Value {
+	res := make(map[string]bitflow.Value, len(metrics))
+	for _, metric := range metrics {
+		res[metric.name] = metric.reader()
+	}
+	return res
+}
+
+func (suite *WindowsTestSuite) TestMaxMetricWindow() {
+	suite.Equal(time.Duration(0), MaxMetricWindow(nil))
+	suite.Equal(time.Hour, MaxMetricWindow(map[*regexp.Regexp]MetricWindows{
+		regexp.MustCompile("a"): {Windows: []time.Duration{time.Minute, time.Hour}},
+		regexp.MustCompile("b"): {Windows: []time.Duration{5 * time.Minute}},
+	}))
+}
+
+func (suite *WindowsTestSuite) TestMatchMetricWindows() {
+	config := map[*regexp.Regexp]MetricWindows{
+		regexp.MustCompile("^net-io/"): {Windows: []time.Duration{time.Minute, 10 * time.Second}},
+		regexp.MustCompile("bytes$"):   {Windows: []time.Duration{time.Minute, 0, time.Hour}, Statistics: true},
+	}
+	windows, statistics := matchMetricWindows(config, "net-io/bytes")
+	suite.Equal([]time.Duration{10 * time.Second, time.Minute, time.Hour}, windows, "sorted, without duplicates and empty windows")
+	suite.True(statistics)
+
+	windows, statistics = matchMetricWindows(config, "net-io/packets")
+	suite.Equal([]time.Duration{10 * time.Second, time.Minute}, windows)
+	suite.False(statistics)
+
+	windows, statistics = matchMetricWindows(config, "cpu")
+	suite.Empty(windows)
+	suite.False(statistics)
+}
+
+func (suite *WindowsTestSuite) TestFormatWindow() {
+	suite.Equal("2h", formatWindow(2*time.Hour))
+	suite.Equal("90m", formatWindow(90*time.Minute))
+	suite.Equal("30s", formatWindow(30*time.Second))
+	suite.Equal("1500ms", formatWindow(1500*time.Millisecond))
+}
+
+func (suite *WindowsTestSuite) TestWindowedMetrics() {
+	nodes := map[*collectorNode]bool{suite.node: true}
+	metrics, metadata := getWindowedMetrics(nodes, nil)
+	suite.Empty(metrics, "no windows configured")
+	suite.Empty(metadata)
+
+	metrics, metadata = getWindowedMetrics(nodes, map[*regexp.Regexp]MetricWindows{
+		regexp.MustCompile("."): {Windows: []time.Duration{2 * time.Second, 5 * time.Second}, Statistics: true},
+	})
+	suite.Len(metrics, 8, "metrics without rings have no windows")
+	suite.Equal(RateMetric("B/s", "Received bytes (over 2s)"), metadata["net-io/bytes/2s"])
+	suite.Equal(RateMetric("B/s", "Standard deviation of the rates of net-io/bytes within 5s"), metadata["net-io/bytes/5s/stddev"])
+
+	suite.fill(StoredValue(0), StoredValue(1), StoredValue(3), StoredValue(6), StoredValue(10), StoredValue(15))
+	values := suite.read(metrics)
+	suite.Equal(bitflow.Value(4), values["net-io/bytes/2s"])
+	suite.Equal(bitflow.Value(4), values["net-io/bytes/2s/min"])
+	suite.Equal(bitflow.Value(5), values["net-io/bytes/2s/max"])
+	suite.Equal(bitflow.Value(0.5), values["net-io/bytes/2s/stddev"])
+	suite.Equal(bitflow.Value(3), values["net-io/bytes/5s"])
+	suite.Equal(bitflow.Value(1), values["net-io/bytes/5s/min"])
+	suite.Equal(bitflow.Value(5), values["net-io/bytes/5s/max"])
+	suite.InDelta(math.Sqrt(2), float64(values["net-io/bytes/5s/stddev"]), 0.0001)
+
+	// The cached statistics are updated after adding new values to the ring
+	suite.fill(StoredValue(25))
+	values = suite.read(metrics)
+	suite.Equal(bitflow.Value(19)/3, values["net-io/bytes/2s"])
+	suite.Equal(bitflow.Value(10), values["net-io/bytes/2s/max"])
+	suite.Equal(bitflow.Value(2), values["net-io/bytes/5s/min"])
+}
+
+func (suite *WindowsTestSuite) TestWindowStats() {
+	suite.Equal(WindowStats{}, suite.ring.GetWindowStats(time.Minute, true), "empty ring")
+	suite.fill(StoredValue(0), StoredValue(1), StoredValue(3), StoredValue(6), StoredValue(10), StoredValue(15))
+
+	// The results must match the separate computations
+	for _, window := range []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second, 3500 * time.Millisecond, time.Hour} {
+		stats := suite.ring.GetWindowStats(window, true)
+		suite.Equal(suite.ring.GetDiffWindow(window), stats.Rate, window)
+		suite.Equal(suite.ring.GetRateStats(window), stats.RateStats, window)
+		suite.Equal(WindowStats{Rate: stats.Rate}, suite.ring.GetWindowStats(window, false), window)
+	}
+
+	// Counter resets are reported, but the ring is only modified by GetDiff()
+	suite.fill(StoredValue(2))
+	suite.Equal(WindowStats{Reset: true}, suite.ring.GetWindowStats(time.Second, false))
+	suite.Equal(WindowStats{Reset: true}, suite.ring.GetWindowStats(time.Minute, true))
+	suite.Equal(uint64(0), suite.ring.Resets())
+	suite.Equal(bitflow.Value(0), suite.ring.GetDiff())
+	suite.Equal(uint64(1), suite.ring.Resets())
+
+	suite.fill(StoredValue(7))
+	suite.Equal(WindowStats{Rate: 5, RateStats: RateStats{Min: 5, Max: 5}}, suite.ring.GetWindowStats(time.Minute, true))
+
+	// A reset within the window is skipped, even if it has not been handled by GetDiff()
+	suite.fill(StoredValue(1), StoredValue(3))
+	suite.Equal(WindowStats{Rate: 2, Reset: true, RateStats: RateStats{Min: 2, Max: 2}}, suite.ring.GetWindowStats(time.Minute, true))
+	suite.Equal(uint64(1), suite.ring.Resets())
+}